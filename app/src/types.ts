@@ -5,10 +5,32 @@ export interface ProcInfo {
   ppid: number;
   name: string;
   cmdline: string;
+  args?: string[];
+  exe?: string;
+  interpreter?: string;
+  entrypoint?: string;
   username: string;
   create_time: string;
   memory_mb: number;
   system_service?: string;
+  cgroup?: CgroupInfo;
+}
+
+// Owner of a process according to its cgroup path
+export interface CgroupInfo {
+  path: string;
+  unit?: string;
+  unit_type?: "service" | "scope" | "slice";
+  slice?: string;
+  manager?: "system" | "user";
+  container_id?: string;
+  container_runtime?: string;
+  pod_uid?: string;
+  pod_qos?: string;
+  flatpak_app?: string;
+  snap_app?: string;
+  owner_kind?: "pod" | "container" | "flatpak" | "snap" | "service" | "scope";
+  owner?: string;
 }
 
 // Port insight data from the engine
@@ -20,6 +42,22 @@ export interface PortInsight {
   age_duration: string;
   is_forgotten: boolean;
   forgotten_reasons?: string[];
+  forgotten_confidence: number;
+  confidence: number;
+  evidence?: string[];
+  probe?: ProbeResult;
+}
+
+// Protocol fingerprint of a listener whose process is not visible
+export interface ProbeResult {
+  protocol: string;
+  detail?: string;
+  http_status?: number;
+  http_server?: string;
+  title?: string;
+  tls_subject?: string;
+  tls_issuer?: string;
+  probed_at: string;
 }
 
 export interface PortSnapshot {
@@ -35,17 +73,112 @@ export interface PortSnapshot {
   traffic?: TrafficInfo;
   risks?: string[];
   project?: ProjectInfo;
+  reservation?: PortReservation;
+  health?: HealthStatus;
+  backlog?: BacklogInfo;
+  container?: ContainerInfo;
+  kube_forward?: KubeForward;
+  forwards_to?: ForwardTarget[];
+}
+
+// Container publishing a port, from the container runtime API
+export interface ContainerInfo {
+  runtime: string; // docker, podman or containerd
+  rootless?: boolean;
+  id: string;
+  name: string;
+  image: string;
+  state: string;
+  status?: string;
+  compose_project?: string;
+  compose_service?: string;
+  container_port: number;
+  labels?: Record<string, string>;
+  cluster?: ClusterNode;
+}
+
+// Local Kubernetes node container (kind, minikube, k3d)
+export interface ClusterNode {
+  distribution: "kind" | "minikube" | "k3d";
+  cluster: string;
+  role?: string;
+}
+
+// Backend a tunnel or proxy hands connections to
+export interface ForwardTarget {
+  via: "ssh" | "socat" | "kubectl" | "nginx" | "caddy";
+  target: string;
+  host?: string;
+  port?: number;
+  gateway?: string; // ssh server resolving host
+  local?: boolean; // target is a listener on this machine
+}
+
+// Parsed kubectl port-forward command
+export interface KubeForward {
+  context?: string;
+  namespace?: string;
+  resource: string;
+  addresses?: string[];
+  mappings: { local: number; remote: string }[];
+}
+
+// Accept queue of a listening socket
+export interface BacklogInfo {
+  queued: number;
+  limit: number;
+  utilization: number;
+  peak_utilization: number;
+  overflows: number;
+  drops: number;
+  saturated: boolean;
+  saturated_since?: string;
+}
+
+export interface HealthSample {
+  at: string;
+  healthy: boolean;
+  status?: number;
+  latency_ms: number;
+  error?: string;
+}
+
+// Result of the HTTP health check configured for a listener
+export interface HealthStatus {
+  url: string;
+  healthy: boolean;
+  consecutive_failures: number;
+  last: HealthSample;
+  history: HealthSample[];
 }
 
 export interface TrafficInfo {
-  tx_queue: number;
-  rx_queue: number;
   is_active: boolean;
+  last_active: string;
+  connections: number;
+  accepts: number;
+  closes: number;
+  conn_rate: number;
+  bytes_in_per_sec: number;
+  bytes_out_per_sec: number;
+  byte_counters: boolean;
 }
 
 export interface ProjectInfo {
   name: string;
   path: string;
+  repo_root?: string;
+  branch?: string;
+  worktree?: string;
+  manifest?: string;
+  package_name?: string;
+}
+
+// Port declared in a project's .portwatch.yml
+export interface PortReservation {
+  project: string;
+  service: string;
+  root: string;
 }
 
 // Kill simulation response for dry-run preview
@@ -58,6 +191,16 @@ export interface KillSimulation {
   system_service?: string;
   protected_reason?: string;
   warnings: string[];
+  container?: ContainerInfo;
+  container_actions?: ("stop" | "restart" | "remove")[];
+}
+
+// POST /container/action
+export interface ContainerActionResult {
+  success: boolean;
+  action: string;
+  container: string;
+  message: string;
 }
 
 // Kill result from graceful termination
@@ -67,6 +210,41 @@ export interface KillResult {
   message: string;
 }
 
+// Process the reaper has warned it will stop
+export interface ReapCandidate {
+  pid: number;
+  process: string;
+  ports: number[];
+  project: string;
+  rule: string;
+  reasons: string[];
+  warned_at: string;
+  act_at: string;
+}
+
+export interface ReapAction extends ReapCandidate {
+  time: string;
+  outcome: "terminated" | "failed" | "protected" | "dry_run";
+  simulation?: KillSimulation;
+  result?: KillResult;
+}
+
+export interface ReapExemption {
+  pid: number;
+  process: string;
+  until?: string;
+}
+
+// GET /reaper
+export interface ReaperStatus {
+  enabled: boolean;
+  dry_run: boolean;
+  pending: ReapCandidate[];
+  snoozed: ReapExemption[];
+  whitelisted: ReapExemption[];
+  recent: ReapAction[];
+}
+
 // Kill state machine for UI feedback
 export type KillState = 
   | { status: "idle" }
@@ -76,4 +254,80 @@ export type KillState =
   | { status: "success"; pid: number; message: string }
   | { status: "error"; pid: number; error: string };
 
+// Dependency graph from GET /graph
+export interface GraphNode {
+  id: string; // pid:<pid>, container:<id> or port:<port>
+  kind: "process" | "container" | "unknown";
+  label: string;
+  pid?: number;
+  container_id?: string;
+  ports?: number[];
+}
+
+export interface GraphEdge {
+  from: string; // client node
+  to: string; // listener node
+  port: number;
+  connections: number;
+}
+
+export interface DependencyGraph {
+  nodes: GraphNode[];
+  edges: GraphEdge[];
+}
 
+// GET /process/{pid}
+export interface ProcessDetail extends ProcInfo {
+  environment?: Record<string, string>; // secrets read "[redacted]"
+  exe_sha256?: string;
+  limits?: { name: string; soft: string; hard: string; unit?: string }[];
+  namespaces?: { type: string; inode: number; host?: boolean }[];
+  open_files?: OpenFile[];
+  threads?: { tid: number; name: string; state?: string }[];
+  truncated?: boolean; // open_files or threads were capped
+  ancestry?: { pid: number; name: string; cmdline?: string; username?: string }[];
+  resources?: ProcessResources;
+}
+
+export interface OpenFile {
+  fd: number;
+  type: "file" | "socket" | "pipe" | "anon" | "other";
+  target: string;
+  socket?: {
+    protocol: "tcp" | "tcp6" | "udp" | "udp6" | "unix";
+    state?: string;
+    local_addr?: string;
+    local_port?: number;
+    remote_addr?: string;
+    remote_port?: number;
+    path?: string;
+  };
+}
+
+export interface ProcessResources {
+  rss_bytes: number;
+  pss_bytes: number;
+  uss_bytes: number;
+  swap_bytes: number;
+  cgroup_memory?: {
+    path: string;
+    usage_bytes: number;
+    limit_bytes?: number; // absent when unlimited
+    utilization?: number;
+  };
+  io?: {
+    read_chars: number;
+    write_chars: number;
+    read_bytes: number;
+    write_bytes: number;
+  };
+  fds?: {
+    open: number;
+    soft_limit?: number;
+    hard_limit?: number;
+    utilization?: number;
+  };
+  near_fd_limit: boolean;
+  near_memory_limit: boolean;
+  warnings?: string[];
+}
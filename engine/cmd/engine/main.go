@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -10,8 +11,11 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"runstate/engine/internal/config"
 	"runstate/engine/internal/engine"
 	"runstate/engine/internal/proc"
+	"runstate/engine/internal/telemetry"
+	"strconv"
 	"syscall"
 	"time"
 )
@@ -21,6 +25,7 @@ func withCORS(w http.ResponseWriter, r *http.Request) bool {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count")
 
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusNoContent)
@@ -33,20 +38,110 @@ func main() {
 	log.SetPrefix("[engine]")
 	mux := http.NewServeMux()
 
+	// Optional user config; a broken file falls back to the built-in defaults
+	configPath := config.Path()
+	if err := engine.LoadConfig(configPath); err != nil {
+		log.Printf("[config] ignoring invalid config: %v", err)
+	}
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	go engine.WatchConfig(configPath, 2*time.Second, stopWatch)
+	go engine.RunReaper(stopWatch)
+
+	// Optional OTLP export of port lifecycle and kill events
+	var exporter *telemetry.Exporter
+	if cfg, ok, err := telemetry.ConfigFromEnv(); err != nil {
+		log.Fatal(err)
+	} else if ok {
+		exporter = telemetry.NewExporter(cfg)
+		engine.Subscribe(exporter.Handle)
+		log.Printf("exporting events to %s", cfg.Endpoint)
+	}
+
+	// Single port scanner, started once subscribers are in place; handlers
+	// and the reaper read its latest result
+	go engine.RunScanner(stopWatch)
+
 	mux.HandleFunc("/ports", func(w http.ResponseWriter, r *http.Request) {
 		if withCORS(w, r) {
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
 
+		query, err := engine.ParsePortQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		data, err := engine.SnapshotPorts()
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		json.NewEncoder(w).Encode(data)
+		page, total := query.Apply(data)
+		result, err := query.Project(page)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		json.NewEncoder(w).Encode(result)
+	})
+	// Dependency graph: which local processes hold connections to which listeners
+	mux.HandleFunc("/graph", func(w http.ResponseWriter, r *http.Request) {
+		if withCORS(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		ports, err := engine.SnapshotPorts()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(engine.BuildGraph(ports))
+	})
+
+	// Full detail of one process: environment, limits, open files, ancestry and resource usage.
+	// The engine may run as root, so only the invoking user's processes are shown.
+	var detailOwner string
+	if u, err := config.InvokingUser(); err != nil {
+		log.Printf("[detail] process detail disabled, invoking user unknown: %v", err)
+	} else {
+		detailOwner = u.Username
+	}
+	mux.HandleFunc("/process/{pid}", func(w http.ResponseWriter, r *http.Request) {
+		if withCORS(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		pid, err := strconv.ParseInt(r.PathValue("pid"), 10, 32)
+		if err != nil || pid <= 0 {
+			http.Error(w, "Invalid pid", http.StatusBadRequest)
+			return
+		}
+
+		if detailOwner == "" {
+			http.Error(w, "Process detail unavailable", http.StatusForbidden)
+			return
+		}
+		detail, err := proc.Detail(int32(pid), detailOwner)
+		if errors.Is(err, proc.ErrNotOwner) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(detail)
 	})
+
 	// Kill simulation endpoint - dry run impact analysis
 	mux.HandleFunc("/kill/simulate", func(w http.ResponseWriter, r *http.Request) {
 		if withCORS(w, r) {
@@ -81,6 +176,7 @@ func main() {
 
 		// Simulate the kill
 		simulation := engine.SimulateKill(req.PID, processes, ports)
+		engine.RecordSimulation()
 		json.NewEncoder(w).Encode(simulation)
 	})
 
@@ -108,40 +204,81 @@ func main() {
 			return
 		}
 
-		targetProc, err := os.FindProcess(req.PID)
+		json.NewEncoder(w).Encode(engine.TerminateProcess(int32(req.PID), req.Force))
+	})
+
+	mux.HandleFunc("/projects", func(w http.ResponseWriter, r *http.Request) {
+		if withCORS(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		processes, err := proc.Snapshot()
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		type KillResult struct {
-			Success bool   `json:"success"`
-			Phase   string `json:"phase"`
-			Message string `json:"message"`
+		ports, err := engine.SnapshotPorts()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
-		// Phase 1: SIGTERM
-		if !req.Force {
-			if err := targetProc.Signal(syscall.SIGTERM); err == nil {
-				// Wait for graceful termination
-				for i := 0; i < 8; i++ {
-					time.Sleep(500 * time.Millisecond)
-					if err := targetProc.Signal(syscall.Signal(0)); err != nil {
-						json.NewEncoder(w).Encode(KillResult{Success: true, Phase: "sigterm", Message: "Terminated gracefully"})
-						return
-					}
-				}
+		json.NewEncoder(w).Encode(engine.GroupProjects(processes, ports))
+	})
+
+	// Project-wide simulate and stop. "project" is a project root path or name.
+	projectAction := func(stop bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if withCORS(w, r) {
+				return
 			}
-		}
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
 
-		// Phase 2: SIGKILL
-		if err := targetProc.Signal(syscall.SIGKILL); err != nil {
-			json.NewEncoder(w).Encode(KillResult{Success: false, Phase: "sigkill", Message: err.Error()})
-			return
-		}
+			var req struct {
+				Project          string `json:"project"`
+				Force            bool   `json:"force"`
+				IncludeProtected bool   `json:"include_protected"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 
-		json.NewEncoder(w).Encode(KillResult{Success: true, Phase: "sigkill", Message: "Force terminated"})
-	})
+			processes, err := proc.Snapshot()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			ports, err := engine.SnapshotPorts()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			group, ok := engine.FindProjectGroup(engine.GroupProjects(processes, ports), req.Project)
+			if !ok {
+				http.Error(w, "Project not found: "+req.Project, http.StatusNotFound)
+				return
+			}
+
+			simulation := engine.SimulateProjectKill(group, processes, ports)
+			engine.RecordSimulation()
+			if !stop {
+				json.NewEncoder(w).Encode(simulation)
+				return
+			}
+			json.NewEncoder(w).Encode(engine.StopProject(simulation, req.Force, req.IncludeProtected))
+		}
+	}
+	mux.HandleFunc("/projects/simulate", projectAction(false))
+	mux.HandleFunc("/projects/stop", projectAction(true))
 
 	mux.HandleFunc("/service/stop", func(w http.ResponseWriter, r *http.Request) {
 		if withCORS(w, r) {
@@ -183,6 +320,139 @@ func main() {
 		})
 	})
 
+	// Container lifecycle actions, offered by /kill/simulate for ports that
+	// belong to a container. "container" is an ID, short ID or name.
+	mux.HandleFunc("/container/action", func(w http.ResponseWriter, r *http.Request) {
+		if withCORS(w, r) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		var req struct {
+			Container string `json:"container"`
+			Action    string `json:"action"`
+			Timeout   int    `json:"timeout"` // seconds before the container is killed
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Container == "" {
+			http.Error(w, "container is required", http.StatusBadRequest)
+			return
+		}
+		timeout := 10 * time.Second
+		if req.Timeout > 0 {
+			timeout = time.Duration(req.Timeout) * time.Second
+		}
+
+		json.NewEncoder(w).Encode(engine.ContainerAction(req.Container, req.Action, timeout))
+	})
+
+	// Automatic reaper: pending warnings, exemptions and recent actions
+	mux.HandleFunc("/reaper", func(w http.ResponseWriter, r *http.Request) {
+		if withCORS(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(engine.GetReaperStatus())
+	})
+
+	mux.HandleFunc("/reaper/snooze", func(w http.ResponseWriter, r *http.Request) {
+		if withCORS(w, r) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		var req struct {
+			PID      int32  `json:"pid"`
+			Duration string `json:"duration"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d := time.Hour
+		if req.Duration != "" {
+			var err error
+			if d, err = time.ParseDuration(req.Duration); err != nil || d <= 0 {
+				http.Error(w, "Invalid duration: "+req.Duration, http.StatusBadRequest)
+				return
+			}
+		}
+
+		exemption, err := engine.SnoozeReap(req.PID, d)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(exemption)
+	})
+
+	mux.HandleFunc("/reaper/whitelist", func(w http.ResponseWriter, r *http.Request) {
+		if withCORS(w, r) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		var req struct {
+			PID int32 `json:"pid"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		exemption, err := engine.WhitelistReap(req.PID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(exemption)
+	})
+
+	// Prometheus scrape endpoint
+	metricsHandler := func(w http.ResponseWriter, r *http.Request) {
+		data, err := engine.SnapshotPorts()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := engine.WriteMetrics(w, data); err != nil {
+			log.Printf("metrics write failed: %v", err)
+		}
+	}
+	mux.HandleFunc("/metrics", metricsHandler)
+
+	// The main listener uses a random port, so optionally expose /metrics on a
+	// fixed loopback address that a local Prometheus can be pointed at.
+	if addr := os.Getenv("PORTWATCH_METRICS_ADDR"); addr != "" {
+		host, _, err := net.SplitHostPort(addr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			log.Fatalf("PORTWATCH_METRICS_ADDR must be a loopback host:port, got %q", addr)
+		}
+		metricsMux := http.NewServeMux()
+		metricsMux.HandleFunc("/metrics", metricsHandler)
+		go func() {
+			if err := http.ListenAndServe(addr, metricsMux); err != nil {
+				log.Printf("metrics listener stopped: %v", err)
+			}
+		}()
+	}
+
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		log.Fatal(err)
@@ -225,5 +495,8 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	server.Shutdown(ctx)
+	if exporter != nil {
+		exporter.Shutdown(ctx)
+	}
 	log.Println("shutdown complete")
 }
@@ -0,0 +1,310 @@
+// Package config loads the optional user configuration file for the engine.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// List extends the built-in defaults with Items, or replaces them entirely
+// when Replace is set.
+type List[T any] struct {
+	Replace bool `yaml:"replace"`
+	Items   []T  `yaml:"items"`
+}
+
+// Map is the map equivalent of List
+type Map[K comparable, V any] struct {
+	Replace bool    `yaml:"replace"`
+	Items   map[K]V `yaml:"items"`
+}
+
+// DevToolPattern is a user-defined process classification rule
+type DevToolPattern struct {
+	Pattern     string         `yaml:"pattern"`
+	Explanation string         `yaml:"explanation"`
+	Icon        string         `yaml:"icon"`
+	Regexp      *regexp.Regexp `yaml:"-"`
+}
+
+// KnownPort describes a well-known port
+type KnownPort struct {
+	Explanation string `yaml:"explanation"`
+	Icon        string `yaml:"icon"`
+}
+
+// NoisePattern is a regex for processes hidden from snapshots
+type NoisePattern struct {
+	Pattern string
+	Regexp  *regexp.Regexp
+}
+
+// UnmarshalYAML lets noise patterns be written as plain strings
+func (n *NoisePattern) UnmarshalYAML(node *yaml.Node) error {
+	return node.Decode(&n.Pattern)
+}
+
+// Config mirrors config.yaml
+type Config struct {
+	DevToolPatterns  List[DevToolPattern]   `yaml:"dev_tool_patterns"`
+	NoisePatterns    List[NoisePattern]     `yaml:"noise_patterns"`
+	IDEPatterns      List[string]           `yaml:"ide_patterns"`
+	TerminalPatterns List[string]           `yaml:"terminal_patterns"`
+	KnownPorts       Map[int, KnownPort]    `yaml:"known_ports"`
+	ProtectedPorts   Map[int, string]       `yaml:"protected_ports"`
+	ProtectedUsers   List[string]           `yaml:"protected_users"`
+	Forgotten        ForgottenConfig        `yaml:"forgotten"`
+	Probe            ProbeConfig            `yaml:"probe"`
+	HealthChecks     List[HealthCheck]      `yaml:"health_checks"`
+	Reaper           ReaperConfig           `yaml:"reaper"`
+	Extra            map[string]interface{} `yaml:",inline"`
+}
+
+// ForgottenConfig tunes forgotten port detection
+type ForgottenConfig struct {
+	Threshold Duration `yaml:"threshold"`
+}
+
+// ProbeConfig enables active protocol probing of unidentified listeners
+type ProbeConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Timeout Duration `yaml:"timeout"`
+}
+
+// HealthCheck is an HTTP check applied to a port, or to every listener whose
+// explanation or command line matches Pattern
+type HealthCheck struct {
+	Port         int            `yaml:"port"`
+	Pattern      string         `yaml:"pattern"`
+	Scheme       string         `yaml:"scheme"`
+	Path         string         `yaml:"path"`
+	ExpectStatus int            `yaml:"expect_status"`
+	Timeout      Duration       `yaml:"timeout"`
+	Interval     Duration       `yaml:"interval"`
+	Regexp       *regexp.Regexp `yaml:"-"`
+}
+
+// ReaperConfig enables automatic termination of forgotten dev processes
+type ReaperConfig struct {
+	Enabled  bool           `yaml:"enabled"`
+	DryRun   bool           `yaml:"dry_run"`
+	Interval Duration       `yaml:"interval"`
+	Grace    Duration       `yaml:"grace"`
+	Rules    []ReapRule     `yaml:"rules"`
+	Exclude  []NoisePattern `yaml:"exclude"`
+}
+
+// ReapRule selects forgotten listeners the reaper may stop. Empty fields
+// match anything, except that a listener must always belong to a project and
+// Users defaults to the invoking user.
+type ReapRule struct {
+	Name          string   `yaml:"name"`
+	Category      string   `yaml:"category"`
+	Projects      []string `yaml:"projects"`
+	Users         []string `yaml:"users"`
+	MinAge        Duration `yaml:"min_age"`
+	IdleFor       Duration `yaml:"idle_for"`
+	MinConfidence float64  `yaml:"min_confidence"`
+	Force         bool     `yaml:"force"`
+}
+
+// Duration accepts Go duration strings such as "10m" or "1h30m"
+type Duration time.Duration
+
+// UnmarshalYAML parses a duration string
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q", node.Line, s)
+	}
+	if v <= 0 {
+		return fmt.Errorf("line %d: duration must be positive, got %q", node.Line, s)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Path returns the config file location: $PORTWATCH_CONFIG if set, otherwise
+// $XDG_CONFIG_HOME/portwatch/config.yaml, falling back to ~/.config. When the
+// engine runs under pkexec the invoking user's home is used rather than root's.
+func Path() string {
+	if p := os.Getenv("PORTWATCH_CONFIG"); p != "" {
+		return p
+	}
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		home, _ := os.UserHomeDir()
+		if uid := os.Getenv("PKEXEC_UID"); uid != "" {
+			if u, err := user.LookupId(uid); err == nil {
+				home = u.HomeDir
+			}
+		}
+		base = filepath.Join(home, ".config")
+	}
+	return filepath.Join(base, "portwatch", "config.yaml")
+}
+
+// InvokingUser returns the user who started the engine: the caller of pkexec
+// or sudo when it runs elevated, otherwise the current user
+func InvokingUser() (*user.User, error) {
+	for _, key := range []string{"PKEXEC_UID", "SUDO_UID"} {
+		if uid := os.Getenv(key); uid != "" {
+			return user.LookupId(uid)
+		}
+	}
+	return user.Current()
+}
+
+// Load reads and validates the config file. A missing file is not an error
+// and yields a nil Config.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse decodes and validates config data
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *Config) validate() error {
+	var errs []error
+
+	for key := range c.Extra {
+		errs = append(errs, fmt.Errorf("unknown key %q", key))
+	}
+
+	for i := range c.DevToolPatterns.Items {
+		p := &c.DevToolPatterns.Items[i]
+		re, err := regexp.Compile(p.Pattern)
+		switch {
+		case p.Pattern == "":
+			errs = append(errs, fmt.Errorf("dev_tool_patterns[%d]: pattern is required", i))
+		case err != nil:
+			errs = append(errs, fmt.Errorf("dev_tool_patterns[%d]: invalid regex %q: %v", i, p.Pattern, err))
+		case p.Explanation == "":
+			errs = append(errs, fmt.Errorf("dev_tool_patterns[%d]: explanation is required", i))
+		}
+		if p.Icon == "" {
+			p.Icon = "system"
+		}
+		p.Regexp = re
+	}
+
+	for i := range c.NoisePatterns.Items {
+		p := &c.NoisePatterns.Items[i]
+		re, err := regexp.Compile(p.Pattern)
+		switch {
+		case p.Pattern == "":
+			errs = append(errs, fmt.Errorf("noise_patterns[%d]: pattern is required", i))
+		case err != nil:
+			errs = append(errs, fmt.Errorf("noise_patterns[%d]: invalid regex %q: %v", i, p.Pattern, err))
+		case re.MatchString(""):
+			// Would hide every process-owned listener
+			errs = append(errs, fmt.Errorf("noise_patterns[%d]: pattern %q matches every process", i, p.Pattern))
+		}
+		p.Regexp = re
+	}
+
+	for i := range c.HealthChecks.Items {
+		hc := &c.HealthChecks.Items[i]
+		if hc.Port == 0 && hc.Pattern == "" {
+			errs = append(errs, fmt.Errorf("health_checks[%d]: port or pattern is required", i))
+		}
+		if hc.Port < 0 || hc.Port > 65535 {
+			errs = append(errs, fmt.Errorf("health_checks[%d]: invalid port %d", i, hc.Port))
+		}
+		if hc.Pattern != "" {
+			re, err := regexp.Compile(hc.Pattern)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("health_checks[%d]: invalid regex %q: %v", i, hc.Pattern, err))
+			}
+			hc.Regexp = re
+		}
+		switch hc.Scheme {
+		case "":
+			hc.Scheme = "http"
+		case "http", "https":
+		default:
+			errs = append(errs, fmt.Errorf("health_checks[%d]: scheme must be http or https, got %q", i, hc.Scheme))
+		}
+		if hc.Path == "" {
+			hc.Path = "/"
+		} else if hc.Path[0] != '/' {
+			errs = append(errs, fmt.Errorf("health_checks[%d]: path must start with /, got %q", i, hc.Path))
+		}
+		if hc.ExpectStatus != 0 && (hc.ExpectStatus < 100 || hc.ExpectStatus > 599) {
+			errs = append(errs, fmt.Errorf("health_checks[%d]: invalid expect_status %d", i, hc.ExpectStatus))
+		}
+	}
+
+	if c.Reaper.Enabled && len(c.Reaper.Rules) == 0 {
+		errs = append(errs, errors.New("reaper: enabled without any rules"))
+	}
+	for i := range c.Reaper.Rules {
+		r := &c.Reaper.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		switch r.Category {
+		case "", "dev", "system", "unidentified":
+		default:
+			errs = append(errs, fmt.Errorf("reaper.rules[%d]: unknown category %q", i, r.Category))
+		}
+		if r.MinConfidence < 0 || r.MinConfidence > 1 {
+			errs = append(errs, fmt.Errorf("reaper.rules[%d]: min_confidence must be between 0 and 1", i))
+		}
+	}
+	for i := range c.Reaper.Exclude {
+		p := &c.Reaper.Exclude[i]
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reaper.exclude[%d]: invalid regex %q: %v", i, p.Pattern, err))
+		}
+		p.Regexp = re
+	}
+
+	for port, kp := range c.KnownPorts.Items {
+		if port < 1 || port > 65535 {
+			errs = append(errs, fmt.Errorf("known_ports: invalid port %d", port))
+		}
+		if kp.Explanation == "" {
+			errs = append(errs, fmt.Errorf("known_ports[%d]: explanation is required", port))
+		}
+	}
+	for port := range c.ProtectedPorts.Items {
+		if port < 1 || port > 65535 {
+			errs = append(errs, fmt.Errorf("protected_ports: invalid port %d", port))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFileNames are the per-project files that declare expected ports
+var ProjectFileNames = []string{".portwatch.yml", ".portwatch.yaml"}
+
+// ProjectFile mirrors .portwatch.yml at a repository root:
+//
+//	name: shop
+//	ports:
+//	  3000: web
+//	  4000: api
+//	  6006: storybook
+type ProjectFile struct {
+	Name  string         `yaml:"name"`
+	Ports map[int]string `yaml:"ports"`
+
+	// Root is the directory containing the file
+	Root string `yaml:"-"`
+}
+
+// FindProjectFile walks up from dir to the filesystem root and returns the
+// first project file found, or nil if there is none.
+func FindProjectFile(dir string) (*ProjectFile, error) {
+	dir = filepath.Clean(dir)
+	for {
+		for _, name := range ProjectFileNames {
+			path := filepath.Join(dir, name)
+			data, err := os.ReadFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			pf, err := ParseProjectFile(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			pf.Root = dir
+			if pf.Name == "" {
+				pf.Name = filepath.Base(dir)
+			}
+			return pf, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// ParseProjectFile decodes and validates a project file
+func ParseProjectFile(data []byte) (*ProjectFile, error) {
+	var pf ProjectFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&pf); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	for port := range pf.Ports {
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("ports: invalid port %d", port)
+		}
+	}
+	return &pf, nil
+}
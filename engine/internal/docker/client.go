@@ -0,0 +1,196 @@
+// Package docker is a minimal client for the Docker Engine API over its Unix
+// socket, covering what port attribution and container actions need.
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSocket is the Docker daemon socket used when DOCKER_HOST is unset
+const DefaultSocket = "/var/run/docker.sock"
+
+// apiVersion is the oldest Engine API version providing every field used here
+const apiVersion = "v1.41"
+
+// Compose labels set by docker compose on every container it creates
+const (
+	LabelComposeProject    = "com.docker.compose.project"
+	LabelComposeService    = "com.docker.compose.service"
+	LabelComposeWorkingDir = "com.docker.compose.project.working_dir"
+	LabelComposeDependsOn  = "com.docker.compose.depends_on"
+)
+
+// PortBinding is a container port, published on the host when PublicPort is set
+type PortBinding struct {
+	IP          string `json:"IP"`
+	PrivatePort int    `json:"PrivatePort"`
+	PublicPort  int    `json:"PublicPort"`
+	Type        string `json:"Type"`
+}
+
+// Container is the subset of the /containers/json response the engine uses
+type Container struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	State  string            `json:"State"`
+	Status string            `json:"Status"`
+	Labels map[string]string `json:"Labels"`
+	Ports  []PortBinding     `json:"Ports"`
+}
+
+// Name returns the primary container name without its leading slash
+func (c Container) Name() string {
+	if len(c.Names) == 0 {
+		return ShortID(c.ID)
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// ShortID returns the 12-character form of a container ID
+func ShortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// Client talks to the Docker Engine API over a Unix socket
+type Client struct {
+	Socket string
+	http   *http.Client
+}
+
+// NewClient returns a client for the daemon listening on socket
+func NewClient(socket string) *Client {
+	return &Client{
+		Socket: socket,
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+				DisableCompression: true,
+			},
+		},
+	}
+}
+
+// SocketFromEnv returns the socket named by a unix:// DOCKER_HOST, or
+// DefaultSocket. Other DOCKER_HOST schemes are not supported.
+func SocketFromEnv() (string, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		return DefaultSocket, nil
+	}
+	if path, ok := strings.CutPrefix(host, "unix://"); ok {
+		return path, nil
+	}
+	return "", fmt.Errorf("docker: unsupported DOCKER_HOST %q, only unix:// is supported", host)
+}
+
+// Available reports whether the socket exists
+func (c *Client) Available() bool {
+	_, err := os.Stat(c.Socket)
+	return err == nil
+}
+
+// Ping checks that the daemon answers
+func (c *Client) Ping(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/_ping", nil, nil)
+}
+
+// ListContainers returns the running containers
+func (c *Client) ListContainers(ctx context.Context) ([]Container, error) {
+	var out []Container
+	if err := c.do(ctx, http.MethodGet, "/containers/json", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// StopContainer stops a container, letting the daemon kill it after timeout.
+// Stopping a container that is not running is not an error.
+func (c *Client) StopContainer(ctx context.Context, id string, timeout time.Duration) error {
+	err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/stop", stopQuery(timeout), nil)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotModified {
+		return nil
+	}
+	return err
+}
+
+// RestartContainer stops and starts a container again
+func (c *Client) RestartContainer(ctx context.Context, id string, timeout time.Duration) error {
+	return c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/restart", stopQuery(timeout), nil)
+}
+
+// RemoveContainer deletes a container. With force a running container is
+// killed first. Volumes are always kept.
+func (c *Client) RemoveContainer(ctx context.Context, id string, force bool) error {
+	q := url.Values{}
+	q.Set("force", strconv.FormatBool(force))
+	return c.do(ctx, http.MethodDelete, "/containers/"+url.PathEscape(id), q, nil)
+}
+
+func stopQuery(timeout time.Duration) url.Values {
+	q := url.Values{}
+	q.Set("t", strconv.Itoa(int(timeout.Seconds())))
+	return q
+}
+
+// APIError is a non-2xx answer from the daemon
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("docker: %s (HTTP %d)", e.Message, e.Status)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, out interface{}) error {
+	u := "http://docker/" + apiVersion + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var body struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(data, &body) != nil || body.Message == "" {
+			body.Message = strings.TrimSpace(string(data))
+		}
+		return &APIError{Status: resp.StatusCode, Message: body.Message}
+	}
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,139 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeDaemon serves handler as a Docker Engine API on a temporary Unix socket
+func fakeDaemon(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Listener = l
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return socket
+}
+
+const containersJSON = `[
+  {
+    "Id": "4f2a9c1e8b7d6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d0c9b8a7f6e5d4c3b2a1f",
+    "Names": ["/shop-db-1"],
+    "Image": "postgres:16",
+    "State": "running",
+    "Status": "Up 2 hours",
+    "Labels": {
+      "com.docker.compose.project": "shop",
+      "com.docker.compose.service": "db",
+      "com.docker.compose.depends_on": ""
+    },
+    "Ports": [
+      {"IP": "0.0.0.0", "PrivatePort": 5432, "PublicPort": 15432, "Type": "tcp"},
+      {"IP": "::", "PrivatePort": 5432, "PublicPort": 15432, "Type": "tcp"},
+      {"PrivatePort": 9187, "Type": "tcp"}
+    ]
+  },
+  {
+    "Id": "abc",
+    "Names": [],
+    "Image": "redis",
+    "State": "running",
+    "Ports": [{"IP": "127.0.0.1", "PrivatePort": 6379, "PublicPort": 6379, "Type": "udp"}]
+  }
+]`
+
+func TestListContainers(t *testing.T) {
+	socket := fakeDaemon(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+apiVersion+"/containers/json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(containersJSON))
+	}))
+
+	list, err := NewClient(socket).ListContainers(context.Background())
+	if err != nil {
+		t.Fatalf("ListContainers: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("got %d containers, want 2", len(list))
+	}
+
+	db := list[0]
+	if db.Name() != "shop-db-1" || db.Image != "postgres:16" || db.State != "running" {
+		t.Errorf("db = %q %q %q", db.Name(), db.Image, db.State)
+	}
+	if db.Labels[LabelComposeProject] != "shop" || db.Labels[LabelComposeService] != "db" {
+		t.Errorf("compose labels = %v", db.Labels)
+	}
+	if len(db.Ports) != 3 || db.Ports[0].PublicPort != 15432 || db.Ports[0].PrivatePort != 5432 || db.Ports[2].PublicPort != 0 {
+		t.Errorf("ports = %+v", db.Ports)
+	}
+
+	// Unnamed containers fall back to the short ID
+	if list[1].Name() != "abc" {
+		t.Errorf("unnamed container name = %q", list[1].Name())
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	socket := fakeDaemon(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + apiVersion + "/containers/json":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"message":"daemon is shutting down"}`))
+		case "/" + apiVersion + "/containers/gone/stop":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("no such container"))
+		case "/" + apiVersion + "/containers/idle/stop":
+			w.WriteHeader(http.StatusNotModified)
+		}
+	}))
+	c := NewClient(socket)
+	ctx := context.Background()
+
+	_, err := c.ListContainers(ctx)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusInternalServerError || apiErr.Message != "daemon is shutting down" {
+		t.Fatalf("ListContainers error = %v", err)
+	}
+
+	// Plain-text bodies are used as the message
+	err = c.StopContainer(ctx, "gone", time.Second)
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound || apiErr.Message != "no such container" {
+		t.Fatalf("StopContainer error = %v", err)
+	}
+
+	// Stopping a stopped container is not an error
+	if err := c.StopContainer(ctx, "idle", time.Second); err != nil {
+		t.Fatalf("StopContainer on a stopped container: %v", err)
+	}
+}
+
+func TestMissingSocket(t *testing.T) {
+	c := NewClient(filepath.Join(t.TempDir(), "missing.sock"))
+	if c.Available() {
+		t.Fatal("Available with no socket")
+	}
+
+	_, err := c.ListContainers(context.Background())
+	if err == nil {
+		t.Fatal("ListContainers succeeded without a daemon")
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		t.Fatalf("dial failure reported as an API error: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"log"
+	"runstate/engine/internal/ports"
+	"sync"
+	"time"
+)
+
+// backlogHigh is the accept queue utilisation treated as close to overflow
+const backlogHigh = 0.8
+
+// BacklogInfo describes the accept queue of a listening socket
+type BacklogInfo struct {
+	Queued          int64      `json:"queued"` // connections waiting for accept()
+	Limit           int64      `json:"limit"`  // backlog passed to listen(), capped by somaxconn; 0 if unknown
+	Utilization     float64    `json:"utilization"`
+	PeakUtilization float64    `json:"peak_utilization"`
+	Overflows       uint64     `json:"overflows"` // system-wide overflows seen while this queue was full
+	Drops           uint64     `json:"drops"`     // system-wide listen drops seen while this queue was full
+	Saturated       bool       `json:"saturated"`
+	SaturatedSince  *time.Time `json:"saturated_since,omitempty"`
+}
+
+type backlogState struct {
+	peak           float64
+	highScans      int
+	wasFull        bool
+	overflows      uint64
+	drops          uint64
+	saturatedSince time.Time
+}
+
+var (
+	backlogMu       sync.Mutex
+	backlogSockets  = make(map[string]*backlogState)
+	lastListenStats *ports.ListenStats
+
+	listenQueuesOnce sync.Once
+	listenStatsOnce  sync.Once
+)
+
+// listenQueues returns the sock_diag view of listener queues, or nil when
+// sock_diag is unavailable
+func listenQueues() map[string]ports.ListenQueue {
+	queues, err := ports.ListenQueues()
+	if err != nil {
+		listenQueuesOnce.Do(func() {
+			log.Printf("[backlog] backlog limits unavailable, using /proc queue lengths only: %v", err)
+		})
+		return nil
+	}
+	return queues
+}
+
+// listenStatsDelta returns the system-wide ListenOverflows and ListenDrops
+// since the previous scan
+func listenStatsDelta() (overflows, drops uint64) {
+	st, err := ports.ReadListenStats()
+	if err != nil {
+		listenStatsOnce.Do(func() {
+			log.Printf("[backlog] overflow counters unavailable: %v", err)
+		})
+		return 0, 0
+	}
+
+	backlogMu.Lock()
+	defer backlogMu.Unlock()
+	if prev := lastListenStats; prev != nil && st.Overflows >= prev.Overflows && st.Drops >= prev.Drops {
+		overflows, drops = st.Overflows-prev.Overflows, st.Drops-prev.Drops
+	}
+	lastListenStats = &st
+	return overflows, drops
+}
+
+// assessBacklog interprets the accept queue of a LISTEN socket. q comes from
+// sock_diag; without it only the queue length from /proc is known and a queue
+// that stays non-empty is the only sign of trouble. The kernel reports
+// overflows system-wide, so new ones are attributed to every listener whose
+// queue was full at this scan or the previous one.
+func assessBacklog(p ports.TcpPort, q ports.ListenQueue, haveLimit bool, overflows, drops uint64, now time.Time) *BacklogInfo {
+	info := &BacklogInfo{Queued: p.RxQueue}
+	full := false
+	high := p.RxQueue > 0
+	if haveLimit {
+		info.Queued, info.Limit = q.Queued, q.Limit
+		// A listener holds one connection more than its backlog before the
+		// kernel starts dropping
+		info.Utilization = float64(q.Queued) / float64(q.Limit+1)
+		full = q.Queued > q.Limit
+		high = info.Utilization >= backlogHigh
+	}
+
+	backlogMu.Lock()
+	defer backlogMu.Unlock()
+
+	st, ok := backlogSockets[p.Inode]
+	if !ok {
+		st = &backlogState{}
+		backlogSockets[p.Inode] = st
+	}
+
+	if high {
+		st.highScans++
+	} else {
+		st.highScans = 0
+	}
+	if full || st.wasFull || (!haveLimit && info.Queued > 0) {
+		st.overflows += overflows
+		st.drops += drops
+	}
+	st.wasFull = full
+	if info.Utilization > st.peak {
+		st.peak = info.Utilization
+	}
+
+	// A single busy scan is a burst; a queue that stays near the limit
+	// belongs to a server that has stopped calling accept()
+	info.Saturated = info.Queued > 0 && (full || st.highScans >= 2)
+	if info.Saturated {
+		if st.saturatedSince.IsZero() {
+			st.saturatedSince = now
+		}
+		since := st.saturatedSince
+		info.SaturatedSince = &since
+	} else {
+		st.saturatedSince = time.Time{}
+	}
+
+	info.PeakUtilization = st.peak
+	info.Overflows = st.overflows
+	info.Drops = st.drops
+	return info
+}
+
+// pruneBacklog forgets sockets that are no longer listening
+func pruneBacklog(listeners []ports.TcpPort) {
+	open := make(map[string]bool, len(listeners))
+	for _, l := range listeners {
+		open[l.Inode] = true
+	}
+
+	backlogMu.Lock()
+	defer backlogMu.Unlock()
+	for inode := range backlogSockets {
+		if !open[inode] {
+			delete(backlogSockets, inode)
+		}
+	}
+}
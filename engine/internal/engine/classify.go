@@ -0,0 +1,460 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"runstate/engine/internal/proc"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ClassifyInput is the evidence available about a process when labelling it
+type ClassifyInput struct {
+	Name    string
+	Cmdline string
+	Args    []string // argv, Args[0] being the command as invoked
+	Exe     string   // resolved executable path, if known
+	Port    int      // listening port, 0 if unknown
+	Parents []proc.ProcInfo
+	Env     map[string]string
+	TTY     string // controlling terminal device, "" if none
+}
+
+// Candidate is one possible label for a process with the score that
+// supports it
+type Candidate struct {
+	Explanation string
+	Icon        string
+	Category    ServiceCategory
+	Score       float64
+	Evidence    []string
+}
+
+// Classification is the winning label and how sure we are about it
+type Classification struct {
+	Explanation string          `json:"explanation"`
+	Icon        string          `json:"icon"`
+	Category    ServiceCategory `json:"category"`
+	Confidence  float64         `json:"confidence"`
+	Evidence    []string        `json:"evidence,omitempty"`
+}
+
+// Classifier proposes candidate labels for a process. Candidates from every
+// registered classifier are merged by explanation and the best score wins.
+type Classifier interface {
+	Classify(in ClassifyInput) []Candidate
+}
+
+// ClassifierFunc adapts a function to the Classifier interface
+type ClassifierFunc func(in ClassifyInput) []Candidate
+
+// Classify implements Classifier
+func (f ClassifierFunc) Classify(in ClassifyInput) []Candidate { return f(in) }
+
+// Evidence weights. A label needs at least minClassifyScore to be used, so a
+// loose substring match on its own is never enough. A conventional port only
+// corroborates other evidence; rules matching on the port alone are dropped.
+const (
+	scoreExecutable  = 3.0
+	scoreEntrypoint  = 3.0
+	scoreSubcommand  = 2.0
+	scoreEnvMarker   = 2.0
+	scoreParent      = 1.5
+	scorePort        = 1.0
+	scorePattern     = 0.75
+	minClassifyScore = 1.0
+)
+
+var (
+	classifiersMu sync.RWMutex
+	classifiers   = []Classifier{
+		ClassifierFunc(classifyByRules),
+		ClassifierFunc(classifyByPatterns),
+		ClassifierFunc(classifyPortForward),
+	}
+)
+
+// RegisterClassifier adds a classifier consulted for every process
+func RegisterClassifier(c Classifier) {
+	classifiersMu.Lock()
+	classifiers = append(classifiers, c)
+	classifiersMu.Unlock()
+}
+
+// ClassifyProcess scores every candidate label for a process and returns the
+// best one. Processes that no classifier recognises fall back to a terminal
+// or system label with zero confidence.
+func ClassifyProcess(in ClassifyInput) Classification {
+	if in.Cmdline == "" && in.Name == "" && len(in.Args) == 0 {
+		return Classification{Explanation: "System or Container Service", Icon: "docker", Category: CategoryDev}
+	}
+
+	classifiersMu.RLock()
+	active := append([]Classifier(nil), classifiers...)
+	classifiersMu.RUnlock()
+
+	merged := make(map[string]*Candidate)
+	var order []string
+	for _, c := range active {
+		for _, cand := range c.Classify(in) {
+			if cand.Score <= 0 {
+				continue
+			}
+			m, ok := merged[cand.Explanation]
+			if !ok {
+				cp := cand
+				cp.Evidence = append([]string(nil), cand.Evidence...)
+				merged[cand.Explanation] = &cp
+				order = append(order, cand.Explanation)
+				continue
+			}
+			m.Score += cand.Score
+			m.Evidence = append(m.Evidence, cand.Evidence...)
+		}
+	}
+
+	// Ties go to the classifier and rule that proposed the label first
+	sort.SliceStable(order, func(i, j int) bool {
+		return merged[order[i]].Score > merged[order[j]].Score
+	})
+
+	if len(order) > 0 {
+		best := merged[order[0]]
+		if best.Score >= minClassifyScore {
+			category := best.Category
+			if category == "" {
+				category = CategoryDev
+			}
+			return Classification{
+				Explanation: best.Explanation,
+				Icon:        best.Icon,
+				Category:    category,
+				Confidence:  scoreConfidence(best.Score),
+				Evidence:    best.Evidence,
+			}
+		}
+	}
+
+	if isTerminalName(in.Name) {
+		return Classification{
+			Explanation: "Terminal Session",
+			Icon:        "terminal",
+			Category:    CategoryDev,
+			Evidence:    []string{fmt.Sprintf("process name %q is a shell or terminal", in.Name)},
+		}
+	}
+
+	if in.Name != "" {
+		return Classification{Explanation: "Started by " + in.Name, Icon: "system", Category: CategorySystem}
+	}
+	return Classification{Explanation: "System Service", Icon: "system", Category: CategorySystem}
+}
+
+// scoreConfidence maps an unbounded score to 0..1; a single strong signal
+// gives about 0.63 and each corroborating signal pushes it higher
+func scoreConfidence(score float64) float64 {
+	c := 1 - math.Exp(-score/scoreExecutable)
+	return math.Round(c*100) / 100
+}
+
+func isTerminalName(name string) bool {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	name = strings.ToLower(name)
+	for _, term := range TerminalPatterns {
+		if name == term {
+			return true
+		}
+	}
+	return false
+}
+
+/* -------------------- argv helpers -------------------- */
+
+// scriptExtensions are stripped when comparing argv entries to rule names,
+// so "node /x/vite.js" and "/x/.bin/vite" both match "vite"
+var scriptExtensions = []string{".js", ".mjs", ".cjs", ".ts", ".py", ".rb", ".jar", ".exe"}
+
+// commandBase reduces an argv entry to a comparable name
+func commandBase(arg string) string {
+	base := strings.ToLower(path.Base(arg))
+	for _, ext := range scriptExtensions {
+		if strings.HasSuffix(base, ext) {
+			return strings.TrimSuffix(base, ext)
+		}
+	}
+	return base
+}
+
+// unversioned strips a trailing version from an executable name:
+// python3.11 -> python, node18 -> node
+func unversioned(name string) string {
+	return strings.TrimRight(name, "0123456789.")
+}
+
+// splitArgs falls back to splitting the joined command line when the real
+// argv is not available
+func splitArgs(in ClassifyInput) []string {
+	if len(in.Args) > 0 {
+		return in.Args
+	}
+	return strings.Fields(in.Cmdline)
+}
+
+/* -------------------- rule classifier -------------------- */
+
+// ServiceRule describes the signals that identify a service. Every matching
+// signal adds to the rule's score.
+type ServiceRule struct {
+	Explanation string
+	Icon        string
+	// Executables match the basename of the executable, argv[0] or the
+	// process name
+	Executables []string
+	// Entrypoints match the basename of any argument, e.g. a script or a
+	// node_modules/.bin entry
+	Entrypoints []string
+	// Subcommands match the argument right after the executable or
+	// entrypoint. When set and none match, the command match only counts half
+	// ("go build" is not "go run").
+	Subcommands []string
+	Ports       []int
+	// Parents match the names of ancestor processes
+	Parents []string
+	// EnvMarkers match environment variable names; a trailing * matches a
+	// prefix
+	EnvMarkers []string
+	// Weight scales the whole rule; generic runtimes use less than 1 so any
+	// specific tool outranks them. Zero means 1.
+	Weight float64
+}
+
+func classifyByRules(in ClassifyInput) []Candidate {
+	args := splitArgs(in)
+	interpreter, _, entryAt := proc.ParseEntrypoint(args, in.Exe)
+
+	var out []Candidate
+	for _, rule := range ServiceRules {
+		if c, ok := rule.match(in, args, interpreter, entryAt); ok {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// match scores a rule. For interpreted processes entryAt is the index of the
+// script or module being run and is the only argument Entrypoints are
+// compared with, so a path that merely mentions a tool does not count.
+func (r ServiceRule) match(in ClassifyInput, args []string, interpreter string, entryAt int) (Candidate, bool) {
+	var score float64
+	var evidence []string
+
+	// Index of the argument after which a subcommand is expected
+	commandAt := -1
+
+	if len(r.Executables) > 0 {
+		names := []string{commandBase(in.Name)}
+		if in.Exe != "" {
+			names = append(names, commandBase(in.Exe))
+		}
+		if len(args) > 0 {
+			names = append(names, commandBase(args[0]))
+		}
+	exe:
+		for _, n := range names {
+			for _, e := range r.Executables {
+				if n == e || unversioned(n) == e {
+					score += scoreExecutable
+					evidence = append(evidence, fmt.Sprintf("executable %q", n))
+					commandAt = 0
+					break exe
+				}
+			}
+		}
+	}
+
+	if len(r.Entrypoints) > 0 {
+		switch {
+		case entryAt >= 0:
+			base := commandBase(args[entryAt])
+			for _, e := range r.Entrypoints {
+				if base == e {
+					score += scoreEntrypoint
+					evidence = append(evidence, fmt.Sprintf("%s entry point %q", interpreter, args[entryAt]))
+					commandAt = entryAt
+					break
+				}
+			}
+		case interpreter != "":
+			// Inline code (-e, -c) has no entry point to match
+		default:
+		entry:
+			for i, a := range args {
+				if i == 0 && commandAt == 0 {
+					continue
+				}
+				if strings.HasPrefix(a, "-") {
+					continue
+				}
+				base := commandBase(a)
+				for _, e := range r.Entrypoints {
+					if base == e {
+						score += scoreEntrypoint
+						evidence = append(evidence, fmt.Sprintf("argument %q", a))
+						commandAt = i
+						break entry
+					}
+				}
+			}
+		}
+	}
+
+	if len(r.Subcommands) > 0 && commandAt >= 0 {
+		sub := ""
+		for _, a := range args[commandAt+1:] {
+			if !strings.HasPrefix(a, "-") {
+				sub = strings.ToLower(a)
+				break
+			}
+		}
+		matched := false
+		for _, s := range r.Subcommands {
+			if sub == s {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			score += scoreSubcommand
+			evidence = append(evidence, fmt.Sprintf("subcommand %q", sub))
+		} else {
+			score /= 2
+		}
+	}
+
+	portScore := 0.0
+	if in.Port > 0 {
+		for _, p := range r.Ports {
+			if in.Port == p {
+				portScore = scorePort
+				score += scorePort
+				evidence = append(evidence, fmt.Sprintf("listening on conventional port %d", p))
+				break
+			}
+		}
+	}
+
+parents:
+	for _, parent := range in.Parents {
+		name := commandBase(parent.Name)
+		for _, p := range r.Parents {
+			if name == p {
+				score += scoreParent
+				evidence = append(evidence, fmt.Sprintf("spawned by %q (pid %d)", parent.Name, parent.PID))
+				break parents
+			}
+		}
+	}
+
+env:
+	for _, marker := range r.EnvMarkers {
+		prefix, isPrefix := strings.CutSuffix(marker, "*")
+		for key := range in.Env {
+			if key == marker || (isPrefix && strings.HasPrefix(key, prefix)) {
+				score += scoreEnvMarker
+				evidence = append(evidence, fmt.Sprintf("environment variable %s", key))
+				break env
+			}
+		}
+	}
+
+	if score-portScore <= 0 {
+		return Candidate{}, false
+	}
+	if r.Weight > 0 {
+		score *= r.Weight
+	}
+	return Candidate{
+		Explanation: r.Explanation,
+		Icon:        r.Icon,
+		Category:    CategoryDev,
+		Score:       score,
+		Evidence:    evidence,
+	}, true
+}
+
+/* -------------------- pattern classifier -------------------- */
+
+// classifyByPatterns scores DevToolPatterns regexes. Built-in patterns are
+// loose substring matches and only corroborate other evidence; patterns from
+// the user config count as much as an executable match.
+func classifyByPatterns(in ClassifyInput) []Candidate {
+	configMu.RLock()
+	builtin, user := DevToolPatterns, UserDevToolPatterns
+	configMu.RUnlock()
+
+	var out []Candidate
+	out = appendPatternMatches(out, in, user, scoreExecutable)
+	out = appendPatternMatches(out, in, builtin, scorePattern)
+	return out
+}
+
+func appendPatternMatches(out []Candidate, in ClassifyInput, patterns []DevToolPattern, weight float64) []Candidate {
+	for _, p := range patterns {
+		var evidence string
+		switch {
+		case p.Pattern.MatchString(in.Cmdline):
+			evidence = fmt.Sprintf("command line matches %s", p.Pattern)
+		case p.Pattern.MatchString(in.Name):
+			evidence = fmt.Sprintf("process name matches %s", p.Pattern)
+		default:
+			continue
+		}
+		out = append(out, Candidate{
+			Explanation: p.Explanation,
+			Icon:        p.Icon,
+			Category:    CategoryDev,
+			Score:       weight,
+			Evidence:    []string{evidence},
+		})
+	}
+	return out
+}
+
+/* -------------------- input assembly -------------------- */
+
+// maxAncestors bounds ancestor walks in case of PID reuse loops
+const maxAncestors = 32
+
+// ancestors returns the parent chain of pid, nearest first
+func ancestors(pid int32, procs map[int32]proc.ProcInfo) []proc.ProcInfo {
+	var out []proc.ProcInfo
+	seen := map[int32]bool{pid: true}
+	p, ok := procs[pid]
+	for ok && len(out) < maxAncestors {
+		parent, found := procs[p.PPID]
+		if !found || seen[parent.PID] {
+			break
+		}
+		seen[parent.PID] = true
+		out = append(out, parent)
+		p = parent
+	}
+	return out
+}
+
+// classifyInputFor gathers classification evidence for a listener
+func classifyInputFor(info proc.ProcInfo, port int, procs map[int32]proc.ProcInfo) ClassifyInput {
+	return ClassifyInput{
+		Name:    info.Name,
+		Cmdline: info.Cmdline,
+		Args:    info.Args,
+		Exe:     info.Exe,
+		Port:    port,
+		Parents: ancestors(info.PID, procs),
+		Env:     proc.Environ(info.PID),
+		TTY:     proc.ControllingTTY(info.PID),
+	}
+}
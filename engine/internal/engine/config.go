@@ -0,0 +1,264 @@
+package engine
+
+import (
+	"log"
+	"os"
+	"regexp"
+	"runstate/engine/internal/config"
+	"sync"
+	"time"
+)
+
+// ForgottenThreshold is how long a port must be open before it can be
+// considered forgotten
+var ForgottenThreshold = 10 * time.Minute
+
+// ProbeEnabled turns on active protocol probing of listeners whose owning
+// process cannot be seen, and ProbeTimeout bounds each probe connection
+var (
+	ProbeEnabled = false
+	ProbeTimeout = 500 * time.Millisecond
+)
+
+// UserDevToolPatterns are the dev_tool_patterns from the config file. Unlike
+// the loose built-in DevToolPatterns, a match on one of these is enough on
+// its own to label a process.
+var UserDevToolPatterns []DevToolPattern
+
+// configMu guards the pattern lists, port tables and thresholds that can be
+// replaced by a config reload
+var configMu sync.RWMutex
+
+// builtinDefaults holds the compiled-in values so that each reload is applied
+// against them rather than on top of the previous reload.
+var builtinDefaults = struct {
+	devTools       []DevToolPattern
+	noise          []*regexp.Regexp
+	ide            []string
+	terminal       []string
+	knownPorts     map[int]KnownPort
+	protectedPorts map[int]string
+	protectedUsers []string
+	forgotten      time.Duration
+	probeEnabled   bool
+	probeTimeout   time.Duration
+	healthChecks   []HealthCheck
+	reaper         ReaperPolicy
+}{
+	devTools:       DevToolPatterns,
+	noise:          NoisePatterns,
+	ide:            IDEPatterns,
+	terminal:       TerminalPatterns,
+	knownPorts:     KnownPorts,
+	protectedPorts: ProtectedPorts,
+	protectedUsers: ProtectedUsers,
+	forgotten:      ForgottenThreshold,
+	probeEnabled:   ProbeEnabled,
+	probeTimeout:   ProbeTimeout,
+	healthChecks:   HealthChecks,
+	reaper:         Reaper,
+}
+
+// ApplyConfig merges a loaded config with the built-in defaults. A nil config
+// restores the defaults.
+func ApplyConfig(cfg *config.Config) {
+	d := builtinDefaults
+
+	devTools := d.devTools
+	var userPatterns []DevToolPattern
+	noise := d.noise
+	ide := d.ide
+	terminal := d.terminal
+	known := d.knownPorts
+	protectedPorts := d.protectedPorts
+	protectedUsers := d.protectedUsers
+	forgotten := d.forgotten
+	probeEnabled := d.probeEnabled
+	probeTimeout := d.probeTimeout
+	healthChecks := d.healthChecks
+	reaper := d.reaper
+
+	if cfg != nil {
+		var userTools []DevToolPattern
+		for _, p := range cfg.DevToolPatterns.Items {
+			userTools = append(userTools, DevToolPattern{p.Regexp, p.Explanation, p.Icon})
+		}
+		if cfg.DevToolPatterns.Replace {
+			devTools = nil
+		}
+		userPatterns = userTools
+
+		var userNoise []*regexp.Regexp
+		for _, p := range cfg.NoisePatterns.Items {
+			userNoise = append(userNoise, p.Regexp)
+		}
+		noise = mergeList(userNoise, noise, cfg.NoisePatterns.Replace)
+
+		ide = mergeList(cfg.IDEPatterns.Items, ide, cfg.IDEPatterns.Replace)
+		terminal = mergeList(cfg.TerminalPatterns.Items, terminal, cfg.TerminalPatterns.Replace)
+		protectedUsers = mergeList(cfg.ProtectedUsers.Items, protectedUsers, cfg.ProtectedUsers.Replace)
+
+		userKnown := make(map[int]KnownPort, len(cfg.KnownPorts.Items))
+		for port, kp := range cfg.KnownPorts.Items {
+			userKnown[port] = KnownPort{kp.Explanation, kp.Icon}
+		}
+		known = mergeMap(userKnown, known, cfg.KnownPorts.Replace)
+		protectedPorts = mergeMap(cfg.ProtectedPorts.Items, protectedPorts, cfg.ProtectedPorts.Replace)
+
+		if cfg.Forgotten.Threshold > 0 {
+			forgotten = time.Duration(cfg.Forgotten.Threshold)
+		}
+		probeEnabled = cfg.Probe.Enabled
+		if cfg.Probe.Timeout > 0 {
+			probeTimeout = time.Duration(cfg.Probe.Timeout)
+		}
+
+		var userChecks []HealthCheck
+		for _, hc := range cfg.HealthChecks.Items {
+			check := HealthCheck{
+				Port:         hc.Port,
+				Pattern:      hc.Regexp,
+				Scheme:       hc.Scheme,
+				Path:         hc.Path,
+				ExpectStatus: hc.ExpectStatus,
+				Timeout:      time.Duration(hc.Timeout),
+				Interval:     time.Duration(hc.Interval),
+			}
+			if check.Timeout == 0 {
+				check.Timeout = defaultHealthTimeout
+			}
+			if check.Interval == 0 {
+				check.Interval = defaultHealthInterval
+			}
+			userChecks = append(userChecks, check)
+		}
+		healthChecks = mergeList(userChecks, healthChecks, cfg.HealthChecks.Replace)
+
+		reaper.Enabled = cfg.Reaper.Enabled
+		reaper.DryRun = cfg.Reaper.DryRun
+		if cfg.Reaper.Interval > 0 {
+			reaper.Interval = time.Duration(cfg.Reaper.Interval)
+		}
+		if cfg.Reaper.Grace > 0 {
+			reaper.Grace = time.Duration(cfg.Reaper.Grace)
+		}
+		reaper.Rules = nil
+		for _, r := range cfg.Reaper.Rules {
+			users := r.Users
+			if len(users) == 0 {
+				// The engine runs as root; never reach beyond the user who
+				// launched it unless the rule says so
+				if u, err := config.InvokingUser(); err == nil {
+					users = []string{u.Username}
+				} else {
+					log.Printf("[reaper] rule %s matches nothing: %v", r.Name, err)
+				}
+			}
+			reaper.Rules = append(reaper.Rules, ReapRule{
+				Name:          r.Name,
+				Category:      ServiceCategory(r.Category),
+				Projects:      r.Projects,
+				Users:         users,
+				MinAge:        time.Duration(r.MinAge),
+				IdleFor:       time.Duration(r.IdleFor),
+				MinConfidence: r.MinConfidence,
+				Force:         r.Force,
+			})
+		}
+		reaper.Exclude = nil
+		for _, p := range cfg.Reaper.Exclude {
+			reaper.Exclude = append(reaper.Exclude, p.Regexp)
+		}
+	}
+
+	configMu.Lock()
+	DevToolPatterns = devTools
+	UserDevToolPatterns = userPatterns
+	NoisePatterns = noise
+	IDEPatterns = ide
+	TerminalPatterns = terminal
+	KnownPorts = known
+	ProtectedPorts = protectedPorts
+	ProtectedUsers = protectedUsers
+	ForgottenThreshold = forgotten
+	ProbeEnabled = probeEnabled
+	ProbeTimeout = probeTimeout
+	HealthChecks = healthChecks
+	Reaper = reaper
+	configMu.Unlock()
+}
+
+func mergeList[T any](user, defaults []T, replace bool) []T {
+	if replace {
+		return user
+	}
+	out := make([]T, 0, len(user)+len(defaults))
+	out = append(out, user...)
+	return append(out, defaults...)
+}
+
+func mergeMap[K comparable, V any](user, defaults map[K]V, replace bool) map[K]V {
+	out := make(map[K]V, len(user)+len(defaults))
+	if !replace {
+		for k, v := range defaults {
+			out[k] = v
+		}
+	}
+	for k, v := range user {
+		out[k] = v
+	}
+	return out
+}
+
+// LoadConfig loads the config file at path and applies it. On error the
+// current configuration is left untouched.
+func LoadConfig(path string) error {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	ApplyConfig(cfg)
+	return nil
+}
+
+// WatchConfig polls the config file and re-applies it whenever its
+// modification time or size changes, until stop is closed. Invalid files are
+// logged and ignored so a typo never takes the engine down.
+func WatchConfig(path string, interval time.Duration, stop <-chan struct{}) {
+	var lastMod time.Time
+	var lastSize int64 = -1
+	if fi, err := os.Stat(path); err == nil {
+		lastMod, lastSize = fi.ModTime(), fi.Size()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			if lastSize != -1 {
+				log.Printf("[config] %s removed, restoring defaults", path)
+				ApplyConfig(nil)
+				lastMod, lastSize = time.Time{}, -1
+			}
+			continue
+		}
+		if fi.ModTime().Equal(lastMod) && fi.Size() == lastSize {
+			continue
+		}
+		lastMod, lastSize = fi.ModTime(), fi.Size()
+
+		if err := LoadConfig(path); err != nil {
+			log.Printf("[config] reload failed, keeping previous config: %v", err)
+			continue
+		}
+		log.Printf("[config] reloaded %s", path)
+	}
+}
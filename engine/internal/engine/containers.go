@@ -0,0 +1,343 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runstate/engine/internal/docker"
+	"runstate/engine/internal/proc"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContainerInfo identifies the container that publishes a port
+type ContainerInfo struct {
+	Runtime        string            `json:"runtime"` // docker, podman or containerd
+	Rootless       bool              `json:"rootless,omitempty"`
+	ID             string            `json:"id"`
+	Name           string            `json:"name"`
+	Image          string            `json:"image"`
+	State          string            `json:"state"`
+	Status         string            `json:"status,omitempty"`
+	ComposeProject string            `json:"compose_project,omitempty"`
+	ComposeService string            `json:"compose_service,omitempty"`
+	ContainerPort  int               `json:"container_port"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Cluster        *ClusterNode      `json:"cluster,omitempty"` // kind, minikube or k3d node
+}
+
+const (
+	// containerRefresh is how long a container listing is reused
+	containerRefresh = 5 * time.Second
+	// containerRetry is how long to wait after no runtime could be reached
+	containerRetry = 30 * time.Second
+	// containerTimeout bounds a listing made while building a snapshot
+	containerTimeout = time.Second
+)
+
+var (
+	containerMu      sync.Mutex
+	containerPorts   map[int]ContainerInfo
+	containerList    []RuntimeContainer
+	containerFetched time.Time
+	containerFailed  bool
+	runtimeFailed    = make(map[string]bool)
+)
+
+// publishedContainerPorts maps host ports to the running containers that
+// publish them, across every reachable runtime. It returns nil when none is
+// reachable.
+func publishedContainerPorts() map[int]ContainerInfo {
+	containerMu.Lock()
+	defer containerMu.Unlock()
+
+	wait := containerRefresh
+	if containerFailed {
+		wait = containerRetry
+	}
+	if !containerFetched.IsZero() && time.Since(containerFetched) < wait {
+		return containerPorts
+	}
+	containerFetched = time.Now()
+
+	runtimes := discoverRuntimes()
+	if len(runtimes) == 0 {
+		containerPorts, containerList, containerFailed = nil, nil, true
+		return nil
+	}
+
+	// Runtimes are listed in parallel so one slow CLI doesn't hold up the
+	// snapshot for the others
+	ctx, cancel := context.WithTimeout(context.Background(), containerTimeout)
+	defer cancel()
+	lists := make([][]RuntimeContainer, len(runtimes))
+	errs := make([]error, len(runtimes))
+	var wg sync.WaitGroup
+	for i, rt := range runtimes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lists[i], errs[i] = rt.List(ctx)
+		}()
+	}
+	wg.Wait()
+
+	var all []RuntimeContainer
+	reached := false
+	for i, rt := range runtimes {
+		key := rt.Name() + ":" + rt.Endpoint()
+		if errs[i] != nil {
+			if !runtimeFailed[key] {
+				log.Printf("[containers] listing %s containers via %s failed: %v", rt.Name(), rt.Endpoint(), errs[i])
+			}
+			runtimeFailed[key] = true
+			continue
+		}
+		runtimeFailed[key] = false
+		reached = true
+		for _, c := range lists[i] {
+			c.runtime = rt
+			c.Info.Cluster = clusterNode(c.Info.Labels)
+			all = append(all, c)
+		}
+	}
+	if !reached {
+		containerPorts, containerList, containerFailed = nil, nil, true
+		return nil
+	}
+	containerFailed = false
+	containerList = all
+
+	out := make(map[int]ContainerInfo)
+	for _, c := range all {
+		for host, ctr := range c.Ports {
+			info := c.Info
+			info.ContainerPort = ctr
+			out[host] = info
+		}
+	}
+	containerPorts = out
+	return out
+}
+
+// applyContainer attributes a listener to the container publishing it. The
+// listener is then owned by docker-proxy, a rootless forwarder such as
+// rootlessport or pasta, or by nothing visible at all, so the container is
+// the better description.
+func applyContainer(ps *PortSnapshot, c ContainerInfo) {
+	ps.Container = &c
+
+	label := c.Name
+	if c.ComposeService != "" {
+		label = c.ComposeProject + "/" + c.ComposeService
+	}
+	ps.Insight.Explanation = "Container " + label + " (" + c.Image + ")"
+	ps.Insight.Icon = "docker"
+	if c.Cluster != nil {
+		ps.Insight.Explanation = clusterPortLabel(c.Cluster, ps.Port, c.ContainerPort)
+		ps.Insight.Icon = "k8s"
+	}
+	ps.Insight.Category = CategoryDev
+	runtime := c.Runtime
+	if c.Rootless {
+		runtime = "rootless " + runtime
+	}
+	ps.Insight.Evidence = append(ps.Insight.Evidence, "published by "+runtime+" container "+docker.ShortID(c.ID))
+
+	if ps.PID == 0 && ps.Process != nil {
+		ps.Process.Name = c.Name
+		ps.Process.Cmdline = runtime + " container " + c.Name + " (" + c.Image + ")"
+		risks := ps.Risks[:0]
+		for _, r := range ps.Risks {
+			if r != "HIDDEN_PROCESS" {
+				risks = append(risks, r)
+			}
+		}
+		ps.Risks = risks
+	}
+
+	if ps.Project == nil {
+		if dir := c.Labels[docker.LabelComposeWorkingDir]; dir != "" {
+			if _, err := os.Stat(dir); err == nil {
+				ps.Project = getProjectInfo(dir)
+			}
+		}
+	}
+}
+
+/* -------------------- container actions -------------------- */
+
+// ContainerActions are the lifecycle actions offered for a container
+var ContainerActions = []string{"stop", "restart", "remove"}
+
+// ContainerActionResult reports the outcome of a container action
+type ContainerActionResult struct {
+	Success   bool   `json:"success"`
+	Action    string `json:"action"`
+	Container string `json:"container"`
+	Message   string `json:"message"`
+}
+
+// findContainer looks a running container up by full or short ID, or name
+func findContainer(key string) (RuntimeContainer, bool) {
+	publishedContainerPorts()
+
+	containerMu.Lock()
+	defer containerMu.Unlock()
+	for _, c := range containerList {
+		if c.Info.ID == key || docker.ShortID(c.Info.ID) == key || c.Info.Name == key {
+			return c, true
+		}
+	}
+	return RuntimeContainer{}, false
+}
+
+// containerForKill returns the container behind a kill target: the container
+// publishing one of its ports (docker-proxy, rootless forwarders), the
+// container whose cgroup the target runs in, or the container run by a
+// containerd shim or podman's conmon found in the target or its ancestors
+func containerForKill(pid int32, processes map[int32]proc.ProcInfo, ports []PortSnapshot, affected []int) *ContainerInfo {
+	for _, ps := range ports {
+		if ps.Container == nil {
+			continue
+		}
+		for _, port := range affected {
+			if ps.Port == port {
+				c := *ps.Container
+				return &c
+			}
+		}
+	}
+
+	p, ok := processes[pid]
+	if !ok {
+		return nil
+	}
+	chain := append([]proc.ProcInfo{p}, ancestors(pid, processes)...)
+	if cg := p.Cgroup; cg != nil && cg.ContainerID != "" {
+		if c, ok := findContainer(cg.ContainerID); ok {
+			return &c.Info
+		}
+	}
+	for _, a := range chain {
+		flag := ""
+		switch {
+		case strings.HasPrefix(a.Name, "containerd-shim"):
+			flag = "-id"
+		case a.Name == "conmon":
+			flag = "-c"
+		default:
+			continue
+		}
+		for i, arg := range a.Args {
+			if arg == flag && i+1 < len(a.Args) {
+				if c, ok := findContainer(a.Args[i+1]); ok {
+					return &c.Info
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// containerWarnings lists what else goes away with a container: its other
+// published ports and the compose services that depend on it
+func containerWarnings(c ContainerInfo, ports []PortSnapshot) []string {
+	var warnings []string
+
+	var published []string
+	for _, ps := range ports {
+		if ps.Container != nil && ps.Container.ID == c.ID {
+			published = append(published, strconv.Itoa(ps.Port))
+		}
+	}
+	if len(published) > 0 {
+		warnings = append(warnings, fmt.Sprintf("Container %s publishes port(s) %s", c.Name, strings.Join(published, ", ")))
+	}
+
+	if c.ComposeProject == "" || c.ComposeService == "" {
+		return warnings
+	}
+
+	containerMu.Lock()
+	defer containerMu.Unlock()
+	var dependents []string
+	for _, other := range containerList {
+		o := other.Info
+		if o.ID == c.ID || o.Runtime != c.Runtime || o.ComposeProject != c.ComposeProject {
+			continue
+		}
+		if dependsOn(o.Labels[docker.LabelComposeDependsOn], c.ComposeService) {
+			dependents = append(dependents, o.ComposeService)
+		}
+	}
+	sort.Strings(dependents)
+	if len(dependents) > 0 {
+		warnings = append(warnings, fmt.Sprintf("Compose services depending on %s/%s: %s",
+			c.ComposeProject, c.ComposeService, strings.Join(dependents, ", ")))
+	}
+	return warnings
+}
+
+// dependsOn parses the compose depends_on label, e.g.
+// "db:service_healthy:false,cache:service_started:true"
+func dependsOn(label, service string) bool {
+	for _, dep := range strings.Split(label, ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(dep), ":")
+		if name == service {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainerAction stops, restarts or removes a container through its
+// runtime. timeout is how long the container gets to exit before it is
+// killed.
+func ContainerAction(key string, action string, timeout time.Duration) ContainerActionResult {
+	res := ContainerActionResult{Action: action, Container: key}
+
+	found, ok := findContainer(key)
+	if !ok {
+		res.Message = "Container not found: " + key
+		return res
+	}
+	c, rt := found.Info, found.runtime
+	res.Container = c.Name
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+10*time.Second)
+	defer cancel()
+
+	var err error
+	switch action {
+	case "stop":
+		err = rt.Stop(ctx, c.ID, timeout)
+	case "restart":
+		err = rt.Restart(ctx, c.ID, timeout)
+	case "remove":
+		if err = rt.Stop(ctx, c.ID, timeout); err == nil {
+			err = rt.Remove(ctx, c.ID)
+		}
+	default:
+		res.Message = "Unknown action: " + action
+		return res
+	}
+
+	// The next snapshot must not reuse the listing from before the action
+	containerMu.Lock()
+	containerFetched = time.Time{}
+	containerMu.Unlock()
+
+	if err != nil {
+		res.Message = fmt.Sprintf("Failed to %s container %s: %v", action, c.Name, err)
+		log.Printf("[containers] %s", res.Message)
+		return res
+	}
+	res.Success = true
+	res.Message = fmt.Sprintf("Container %s: %s done", c.Name, action)
+	return res
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"runstate/engine/internal/proc"
+	"sync"
+	"time"
+)
+
+// EventKind identifies a port lifecycle or user action event
+type EventKind string
+
+const (
+	EventPortOpen  EventKind = "port_open"
+	EventPortClose EventKind = "port_close"
+	EventKill      EventKind = "kill"
+	// EventReapWarning announces that the reaper will stop a process once
+	// its grace period is over
+	EventReapWarning EventKind = "reap_warning"
+)
+
+// PortEvent is emitted when a listener appears or disappears, when a process
+// is killed through the engine, or before the reaper stops one.
+type PortEvent struct {
+	Kind    EventKind      `json:"kind"`
+	Time    time.Time      `json:"time"`
+	Port    int            `json:"port,omitempty"`
+	PID     int32          `json:"pid"`
+	Process *proc.ProcInfo `json:"process,omitempty"`
+	Project *ProjectInfo   `json:"project,omitempty"`
+	Insight *PortInsight   `json:"insight,omitempty"`
+
+	// Kill events only
+	Phase   string `json:"phase,omitempty"`
+	Success bool   `json:"success,omitempty"`
+
+	// Reap warnings only
+	Rule  string    `json:"rule,omitempty"`
+	ActAt time.Time `json:"act_at,omitempty"`
+}
+
+var (
+	subscribersMu sync.RWMutex
+	subscribers   []func(PortEvent)
+)
+
+// Subscribe registers fn to receive every event. Handlers run synchronously
+// on the scanning goroutine and must not block.
+func Subscribe(fn func(PortEvent)) {
+	subscribersMu.Lock()
+	subscribers = append(subscribers, fn)
+	subscribersMu.Unlock()
+}
+
+func publish(ev PortEvent) {
+	subscribersMu.RLock()
+	defer subscribersMu.RUnlock()
+	for _, fn := range subscribers {
+		fn(ev)
+	}
+}
+
+func portEvent(kind EventKind, ps PortSnapshot, at time.Time) PortEvent {
+	return PortEvent{
+		Kind:    kind,
+		Time:    at,
+		Port:    ps.Port,
+		PID:     ps.PID,
+		Process: ps.Process,
+		Project: ps.Project,
+		Insight: ps.Insight,
+	}
+}
+
+// lastKnownPort returns the most recent snapshot of a port held by pid, so
+// that kill events can carry process metadata after the process is gone.
+func lastKnownPort(pid int32) (PortSnapshot, bool) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	for k, entry := range portState {
+		if k.Inode == pidKey(pid) && entry.Last != nil {
+			return *entry.Last, true
+		}
+	}
+	return PortSnapshot{}, false
+}
@@ -0,0 +1,280 @@
+package engine
+
+import (
+	"net"
+	"runstate/engine/internal/proc"
+	"strconv"
+	"strings"
+)
+
+// ForwardTarget is a backend a listener hands its connections to
+type ForwardTarget struct {
+	Via    string `json:"via"`    // ssh, socat, kubectl, nginx, caddy
+	Target string `json:"target"` // as configured, e.g. "db:5432" or "svc/api:80"
+	Host   string `json:"host,omitempty"`
+	Port   int    `json:"port,omitempty"`
+	// Gateway is the ssh server that resolves Host for a tunnel
+	Gateway string `json:"gateway,omitempty"`
+	// Local is set when the target is a listener in this snapshot
+	Local bool `json:"local,omitempty"`
+}
+
+// forwardsFor returns the backends the process forwards a listening port to,
+// from its argv or, for reverse proxies, its config files
+func forwardsFor(info proc.ProcInfo, port int, procs map[int32]proc.ProcInfo) []ForwardTarget {
+	args := info.Args
+	if len(args) == 0 {
+		return nil
+	}
+	if kf, ok := ParsePortForward(args); ok {
+		if m, ok := kf.MappingFor(port); ok {
+			target := kf.Resource + ":" + m.Remote
+			if kf.Namespace != "" {
+				target += " (ns " + kf.Namespace + ")"
+			}
+			t := ForwardTarget{Via: "kubectl", Target: target, Host: kf.Resource}
+			t.Port, _ = strconv.Atoi(m.Remote)
+			return []ForwardTarget{t}
+		}
+		return nil
+	}
+
+	name := info.Name
+	if name == "" {
+		name = unversioned(commandBase(args[0]))
+	}
+	switch name {
+	case "ssh", "autossh":
+		return parseSSHForwards(args)[port]
+	case "socat":
+		if listen, t, ok := parseSocat(args); ok && listen == port {
+			return []ForwardTarget{t}
+		}
+		return nil
+	case "nginx":
+		// Workers share the master's listeners; only the master's argv
+		// names the config
+		master := info
+		if parent, ok := procs[info.PPID]; ok && parent.Name == "nginx" {
+			master = parent
+		}
+		return proxyUpstreams(master, nginxConfigPath(master), parseNginxConfig)[port]
+	case "caddy":
+		if t, ok := parseCaddyReverseProxy(args); ok {
+			return t[port]
+		}
+		return proxyUpstreams(info, caddyfilePath(info), parseCaddyfile)[port]
+	}
+	return nil
+}
+
+// markLocalForwards flags forward targets that point at another listener in
+// the same snapshot
+func markLocalForwards(out []PortSnapshot) {
+	open := make(map[int]bool, len(out))
+	for _, ps := range out {
+		open[ps.Port] = true
+	}
+	for i := range out {
+		for j := range out[i].ForwardsTo {
+			t := &out[i].ForwardsTo[j]
+			t.Local = t.Gateway == "" && t.Via != "kubectl" && isLocalHost(t.Host) && open[t.Port]
+		}
+	}
+}
+
+func isLocalHost(host string) bool {
+	if host == "" || host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
+
+// splitHostPort splits "host:port", "[v6]:port" or a bare port
+func splitHostPort(s string) (string, int, bool) {
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		host, portStr = "", s
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, false
+	}
+	return host, port, true
+}
+
+/* -------------------- ssh -------------------- */
+
+// sshValueFlags are the ssh options that take an argument
+const sshValueFlags = "BbcDEeFIiJLlmOoPpQRSWw"
+
+// parseSSHForwards reads -L local forwards, LocalForward options and -D
+// SOCKS proxies from ssh argv, keyed by local port
+func parseSSHForwards(args []string) map[int][]ForwardTarget {
+	var specs []string
+	var dynamic []string
+	gateway := ""
+
+	for i := 1; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			if i+1 < len(args) && gateway == "" {
+				gateway = args[i+1]
+			}
+			break
+		}
+		if !strings.HasPrefix(a, "-") || len(a) < 2 {
+			// OpenSSH accepts options after the destination; anything else
+			// after it is the remote command
+			if gateway != "" {
+				break
+			}
+			gateway = a
+			continue
+		}
+
+		// Flags combine getopt-style: -fNL 5432:db:5432
+		for j := 1; j < len(a); j++ {
+			flag := a[j]
+			if !strings.ContainsRune(sshValueFlags, rune(flag)) {
+				continue
+			}
+			value := a[j+1:]
+			if value == "" && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			switch flag {
+			case 'L':
+				specs = append(specs, value)
+			case 'D':
+				dynamic = append(dynamic, value)
+			case 'o':
+				key, v, _ := strings.Cut(value, "=")
+				if !strings.EqualFold(strings.TrimSpace(key), "LocalForward") {
+					break
+				}
+				// LocalForward [bind:]port host:hostport
+				if f := strings.Fields(v); len(f) == 2 {
+					specs = append(specs, f[0]+":"+f[1])
+				}
+			}
+			break
+		}
+	}
+	if user, host, ok := strings.Cut(gateway, "@"); ok && user != "" {
+		gateway = host
+	}
+
+	out := make(map[int][]ForwardTarget)
+	for _, spec := range specs {
+		local, target, ok := splitSSHForward(spec)
+		if !ok {
+			continue
+		}
+		t := ForwardTarget{Via: "ssh", Target: target, Gateway: gateway}
+		t.Host, t.Port, _ = splitHostPort(target)
+		out[local] = append(out[local], t)
+	}
+	for _, spec := range dynamic {
+		if _, port, ok := splitHostPort(spec); ok {
+			out[port] = append(out[port], ForwardTarget{Via: "ssh", Target: "SOCKS proxy", Gateway: gateway})
+		}
+	}
+	return out
+}
+
+// splitSSHForward parses [bind_address:]port:host:hostport, with bracketed
+// IPv6 addresses, or a forward to a remote Unix socket
+func splitSSHForward(spec string) (int, string, bool) {
+	fields := splitBracketed(spec)
+	switch len(fields) {
+	case 2: // port:/remote/socket
+		port, err := strconv.Atoi(fields[0])
+		return port, fields[1], err == nil && strings.HasPrefix(fields[1], "/")
+	case 3:
+		port, err := strconv.Atoi(fields[0])
+		return port, net.JoinHostPort(fields[1], fields[2]), err == nil
+	case 4:
+		port, err := strconv.Atoi(fields[1])
+		return port, net.JoinHostPort(fields[2], fields[3]), err == nil
+	}
+	return 0, "", false
+}
+
+// splitBracketed splits on colons outside [...]
+func splitBracketed(s string) []string {
+	var out []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ':':
+			if depth == 0 {
+				out = append(out, strings.Trim(s[start:i], "[]"))
+				start = i + 1
+			}
+		}
+	}
+	return append(out, strings.Trim(s[start:], "[]"))
+}
+
+/* -------------------- socat -------------------- */
+
+// socatValueFlags are the socat options that take a separate argument
+var socatValueFlags = map[string]bool{"-b": true, "-t": true, "-T": true, "-lf": true, "-lp": true}
+
+// parseSocat reads `socat TCP-LISTEN:port,... TCP:host:port` style argv
+func parseSocat(args []string) (int, ForwardTarget, bool) {
+	var addrs []string
+	for i := 1; i < len(args); i++ {
+		a := args[i]
+		if socatValueFlags[a] {
+			i++
+			continue
+		}
+		if strings.HasPrefix(a, "-") && len(a) > 1 {
+			continue
+		}
+		addrs = append(addrs, a)
+	}
+	if len(addrs) != 2 {
+		return 0, ForwardTarget{}, false
+	}
+
+	listen, port := -1, 0
+	for i, a := range addrs {
+		kind, rest, _ := strings.Cut(a, ":")
+		switch strings.ToUpper(kind) {
+		case "TCP-LISTEN", "TCP4-LISTEN", "TCP6-LISTEN", "TCP-L", "TCP4-L", "TCP6-L":
+			if n, err := strconv.Atoi(strings.SplitN(rest, ",", 2)[0]); err == nil && listen < 0 {
+				listen, port = i, n
+			}
+		}
+	}
+	if listen < 0 {
+		return 0, ForwardTarget{}, false
+	}
+
+	kind, rest, _ := strings.Cut(addrs[1-listen], ":")
+	rest = strings.SplitN(rest, ",", 2)[0]
+	t := ForwardTarget{Via: "socat", Target: rest}
+	switch strings.ToUpper(kind) {
+	case "TCP", "TCP4", "TCP6", "TCP-CONNECT", "TCP4-CONNECT", "TCP6-CONNECT", "OPENSSL", "SSL":
+		// socat writes IPv6 hosts in brackets: TCP6:[::1]:3000
+		if i := strings.LastIndexByte(rest, ':'); i > 0 {
+			t.Host = strings.Trim(rest[:i], "[]")
+			t.Port, _ = strconv.Atoi(rest[i+1:])
+			t.Target = net.JoinHostPort(t.Host, rest[i+1:])
+		}
+	case "UNIX-CONNECT", "UNIX-CLIENT", "UNIX":
+		// Target is the socket path
+	default:
+		t.Target = addrs[1-listen]
+	}
+	return port, t, true
+}
@@ -0,0 +1,302 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"runstate/engine/internal/docker"
+	"runstate/engine/internal/ports"
+	"runstate/engine/internal/proc"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DependencyGraph shows which local processes and containers hold
+// connections to which local listeners
+type DependencyGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a process, a container, or a listener whose owner is hidden
+type GraphNode struct {
+	ID          string `json:"id"`   // pid:<pid>, container:<id> or port:<port>
+	Kind        string `json:"kind"` // process, container or unknown
+	Label       string `json:"label"`
+	PID         int32  `json:"pid,omitempty"`
+	ContainerID string `json:"container_id,omitempty"`
+	Ports       []int  `json:"ports,omitempty"` // listening ports
+}
+
+// GraphEdge is a client talking to a listener
+type GraphEdge struct {
+	From        string `json:"from"` // client node
+	To          string `json:"to"`   // listener node
+	Port        int    `json:"port"`
+	Connections int    `json:"connections"`
+}
+
+// localClient is one established connection from a local process to a local
+// listener
+type localClient struct {
+	pid  int32 // 0 if the socket's owner is not visible
+	port int
+}
+
+// localClients finds the client halves of connections to listeners in ports.
+// The server half of a connection has the listener's port as its local port,
+// the client half has it as its remote port and a local remote address.
+func localClients(snapshot []PortSnapshot) []localClient {
+	listening := make(map[int]bool, len(snapshot))
+	for _, ps := range snapshot {
+		listening[ps.Port] = true
+	}
+
+	conns, err := ports.ListTCPConnections()
+	if err != nil {
+		log.Printf("[graph] listing connections failed: %v", err)
+		return nil
+	}
+
+	local := localAddrs()
+	var candidates []ports.TcpConn
+	for _, c := range conns {
+		if listening[c.RemotePort] && local(c.RemoteAddr) {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	owners := socketOwnersOf(candidates)
+	out := make([]localClient, 0, len(candidates))
+	for _, c := range candidates {
+		out = append(out, localClient{pid: owners[c.Inode], port: c.RemotePort})
+	}
+	return out
+}
+
+// socketOwnersOf resolves the owners of connections from the latest port
+// scan, scanning /proc only for sockets opened since
+func socketOwnersOf(conns []ports.TcpConn) map[string]int32 {
+	stateMu.Lock()
+	known := lastOwners
+	stateMu.Unlock()
+
+	owners := make(map[string]int32, len(conns))
+	missing := make(map[string]bool)
+	for _, c := range conns {
+		if pid, ok := known[c.Inode]; ok {
+			owners[c.Inode] = pid
+		} else {
+			missing[c.Inode] = true
+		}
+	}
+	for inode, pid := range ports.SocketOwnersOf(missing) {
+		owners[inode] = pid
+	}
+	return owners
+}
+
+// localAddrs returns a predicate for addresses of this host
+func localAddrs() func(string) bool {
+	own := make(map[string]bool)
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok {
+				own[ipnet.IP.String()] = true
+			}
+		}
+	}
+	return func(addr string) bool {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return false
+		}
+		return ip.IsLoopback() || own[ip.String()]
+	}
+}
+
+// BuildGraph combines listeners with the established connections to them.
+// Processes running in a container are folded into the container's node.
+// Only listener owners and clients are read from /proc.
+func BuildGraph(snapshot []PortSnapshot) DependencyGraph {
+	clients := localClients(snapshot)
+	var pids []int32
+	for _, ps := range snapshot {
+		if ps.PID > 0 {
+			pids = append(pids, ps.PID)
+		}
+	}
+	for _, c := range clients {
+		if c.pid > 0 {
+			pids = append(pids, c.pid)
+		}
+	}
+	processes := proc.SnapshotPIDs(pids)
+
+	nodes := make(map[string]*GraphNode)
+	node := func(n GraphNode) *GraphNode {
+		if existing, ok := nodes[n.ID]; ok {
+			return existing
+		}
+		nodes[n.ID] = &n
+		return &n
+	}
+
+	byPort := make(map[int]string, len(snapshot))
+	for _, ps := range snapshot {
+		var n *GraphNode
+		switch {
+		case ps.Container != nil:
+			n = node(containerNode(ps.Container.ID, ps.Container.Name))
+		case ps.PID > 0:
+			n = node(processNode(ps.PID, processes))
+		default:
+			label := "port " + strconv.Itoa(ps.Port)
+			if ps.Insight != nil {
+				label = ps.Insight.Explanation
+			}
+			n = node(GraphNode{ID: "port:" + strconv.Itoa(ps.Port), Kind: "unknown", Label: label})
+		}
+		n.Ports = append(n.Ports, ps.Port)
+		byPort[ps.Port] = n.ID
+	}
+
+	type edgeKey struct {
+		from, to string
+		port     int
+	}
+	counts := make(map[edgeKey]int)
+	for _, c := range clients {
+		from := "unknown"
+		if c.pid > 0 {
+			from = node(processNode(c.pid, processes)).ID
+		} else {
+			node(GraphNode{ID: from, Kind: "unknown", Label: "Unknown client"})
+		}
+		to := byPort[c.port]
+		if from == to {
+			continue
+		}
+		counts[edgeKey{from, to, c.port}]++
+	}
+
+	g := DependencyGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for k, n := range counts {
+		g.Edges = append(g.Edges, GraphEdge{From: k.from, To: k.to, Port: k.port, Connections: n})
+	}
+	for _, n := range nodes {
+		sort.Ints(n.Ports)
+		g.Nodes = append(g.Nodes, *n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.From < b.From
+	})
+	return g
+}
+
+// processNode describes a PID, or the container it runs in
+func processNode(pid int32, processes map[int32]proc.ProcInfo) GraphNode {
+	p, ok := processes[pid]
+	if !ok {
+		return GraphNode{ID: fmt.Sprintf("pid:%d", pid), Kind: "process", Label: fmt.Sprintf("pid %d", pid), PID: pid}
+	}
+	if cg := p.Cgroup; cg != nil && cg.ContainerID != "" {
+		name := docker.ShortID(cg.ContainerID)
+		if c, ok := cachedContainer(cg.ContainerID); ok {
+			name = c.Name
+		}
+		return containerNode(cg.ContainerID, name)
+	}
+	return GraphNode{ID: fmt.Sprintf("pid:%d", pid), Kind: "process", Label: p.Name, PID: pid}
+}
+
+func containerNode(id, name string) GraphNode {
+	return GraphNode{ID: "container:" + docker.ShortID(id), Kind: "container", Label: name, ContainerID: id}
+}
+
+// cachedContainer looks a container up in the last listing without
+// refreshing it
+func cachedContainer(id string) (ContainerInfo, bool) {
+	containerMu.Lock()
+	defer containerMu.Unlock()
+	for _, c := range containerList {
+		if c.Info.ID == id {
+			return c.Info, true
+		}
+	}
+	return ContainerInfo{}, false
+}
+
+// clientWarning summarises the local clients of the ports a kill takes down,
+// ignoring clients that go down with it
+func clientWarning(affected []int, dying map[int32]bool, processes map[int32]proc.ProcInfo, snapshot []PortSnapshot) string {
+	if len(affected) == 0 {
+		return ""
+	}
+	targeted := make(map[int]bool, len(affected))
+	for _, p := range affected {
+		targeted[p] = true
+	}
+
+	total := 0
+	byName := make(map[string]int)
+	portSet := make(map[int]bool)
+	for _, c := range localClients(snapshot) {
+		if !targeted[c.port] || (c.pid > 0 && dying[c.pid]) {
+			continue
+		}
+		total++
+		portSet[c.port] = true
+		name := "unknown"
+		if c.pid > 0 {
+			name = processNode(c.pid, processes).Label
+		}
+		byName[name]++
+	}
+	if total == 0 {
+		return ""
+	}
+
+	var names []string
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if byName[names[i]] != byName[names[j]] {
+			return byName[names[i]] > byName[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for i, name := range names {
+		names[i] = fmt.Sprintf("%s (%d)", name, byName[name])
+	}
+	var portList []int
+	for p := range portSet {
+		portList = append(portList, p)
+	}
+	sort.Ints(portList)
+	portStrs := make([]string, len(portList))
+	for i, p := range portList {
+		portStrs[i] = strconv.Itoa(p)
+	}
+
+	noun := "clients are"
+	if total == 1 {
+		noun = "client is"
+	}
+	what := "this port"
+	if len(portList) > 1 {
+		what = "these ports"
+	}
+	return fmt.Sprintf("%d local %s connected to %s (%s): %s",
+		total, noun, what, strings.Join(portStrs, ", "), strings.Join(names, ", "))
+}
@@ -0,0 +1,222 @@
+package engine
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HealthCheck is an HTTP GET run periodically against a listener. A check
+// applies to Port, or to any listener whose explanation or command line
+// matches Pattern.
+type HealthCheck struct {
+	Port         int
+	Pattern      *regexp.Regexp
+	Scheme       string
+	Path         string
+	ExpectStatus int // 0 accepts any status below 500
+	Timeout      time.Duration
+	Interval     time.Duration
+}
+
+// HealthChecks are evaluated in order; the first one matching a listener wins.
+// None are built in: a GET is not free on a dev server (Next.js compiles the
+// route it serves), so only configured checks run.
+var HealthChecks []HealthCheck
+
+const (
+	defaultHealthTimeout  = 2 * time.Second
+	defaultHealthInterval = 30 * time.Second
+
+	// maxHealthHistory bounds the samples kept per listener
+	maxHealthHistory = 20
+	// maxConcurrentHealthChecks bounds background check goroutines
+	maxConcurrentHealthChecks = 4
+)
+
+// HealthSample is the outcome of one check
+type HealthSample struct {
+	At        time.Time `json:"at"`
+	Healthy   bool      `json:"healthy"`
+	Status    int       `json:"status,omitempty"`
+	LatencyMs float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// HealthStatus is the latest check result for a listener and its recent history
+type HealthStatus struct {
+	URL                 string         `json:"url"`
+	Healthy             bool           `json:"healthy"`
+	ConsecutiveFailures int            `json:"consecutive_failures"`
+	Last                HealthSample   `json:"last"`
+	History             []HealthSample `json:"history"`
+}
+
+type healthEntry struct {
+	firstSeen time.Time
+	url       string
+	status    *HealthStatus
+	running   bool
+}
+
+var (
+	healthMu    sync.Mutex
+	healthState = make(map[int]*healthEntry)
+	healthSlots = make(chan struct{}, maxConcurrentHealthChecks)
+)
+
+// matchHealthCheck returns the first configured check for a listener
+func matchHealthCheck(ps PortSnapshot) (HealthCheck, bool) {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	for _, hc := range HealthChecks {
+		if hc.Port != 0 && hc.Port != ps.Port {
+			continue
+		}
+		if hc.Pattern != nil {
+			matched := ps.Insight != nil && hc.Pattern.MatchString(ps.Insight.Explanation)
+			if !matched && ps.Process != nil {
+				matched = hc.Pattern.MatchString(ps.Process.Cmdline)
+			}
+			if !matched {
+				continue
+			}
+		}
+		return hc, true
+	}
+	return HealthCheck{}, false
+}
+
+// checkHealth returns the health of a listener as of the last completed
+// check, and starts a new check in the background when one is due
+func checkHealth(ps PortSnapshot) *HealthStatus {
+	hc, ok := matchHealthCheck(ps)
+	if !ok {
+		return nil
+	}
+	host := probeHost(ps)
+	if host == "" {
+		return nil
+	}
+	url := hc.Scheme + "://" + net.JoinHostPort(host, strconv.Itoa(ps.Port)) + hc.Path
+
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	entry, ok := healthState[ps.Port]
+	if !ok || !entry.firstSeen.Equal(ps.FirstSeen) || entry.url != url {
+		// A new listener or a different check starts a fresh history
+		entry = &healthEntry{firstSeen: ps.FirstSeen, url: url}
+		healthState[ps.Port] = entry
+	}
+
+	due := entry.status == nil || time.Since(entry.status.Last.At) >= hc.Interval
+	if due && !entry.running {
+		entry.running = true
+		go runHealthCheck(ps.Port, entry, hc)
+	}
+
+	if entry.status == nil {
+		return nil
+	}
+	out := *entry.status
+	out.History = append([]HealthSample(nil), entry.status.History...)
+	return &out
+}
+
+func runHealthCheck(port int, entry *healthEntry, hc HealthCheck) {
+	healthSlots <- struct{}{}
+	defer func() { <-healthSlots }()
+
+	sample := doHealthCheck(entry.url, hc)
+
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	entry.running = false
+	if healthState[port] != entry {
+		// The listener went away or was replaced while the check ran
+		return
+	}
+
+	st := entry.status
+	if st == nil {
+		st = &HealthStatus{URL: entry.url}
+		entry.status = st
+	}
+	st.Last = sample
+	st.Healthy = sample.Healthy
+	if sample.Healthy {
+		st.ConsecutiveFailures = 0
+	} else {
+		st.ConsecutiveFailures++
+	}
+	st.History = append(st.History, sample)
+	if len(st.History) > maxHealthHistory {
+		st.History = st.History[len(st.History)-maxHealthHistory:]
+	}
+}
+
+func doHealthCheck(url string, hc HealthCheck) HealthSample {
+	client := &http.Client{
+		Timeout: hc.Timeout,
+		Transport: &http.Transport{
+			// Dev servers use self-signed certificates; reachability is what matters
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+			Proxy:             nil,
+		},
+		// A redirect to a login page still means the server is answering
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	start := time.Now()
+	sample := HealthSample{At: start}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		sample.Error = err.Error()
+		return sample
+	}
+	req.Header.Set("User-Agent", "portwatch-health")
+
+	resp, err := client.Do(req)
+	sample.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		sample.Error = err.Error()
+		return sample
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	sample.Status = resp.StatusCode
+	if hc.ExpectStatus != 0 {
+		sample.Healthy = resp.StatusCode == hc.ExpectStatus
+		if !sample.Healthy {
+			sample.Error = fmt.Sprintf("expected status %d, got %d", hc.ExpectStatus, resp.StatusCode)
+		}
+	} else {
+		sample.Healthy = resp.StatusCode < 500
+		if !sample.Healthy {
+			sample.Error = fmt.Sprintf("server error %d", resp.StatusCode)
+		}
+	}
+	return sample
+}
+
+// pruneHealth forgets history for ports no longer listening
+func pruneHealth(open map[int]bool) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	for port := range healthState {
+		if !open[port] {
+			delete(healthState, port)
+		}
+	}
+}
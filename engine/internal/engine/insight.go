@@ -2,7 +2,11 @@ package engine
 
 import (
 	"fmt"
+	"math"
+	"os"
 	"regexp"
+	"runstate/engine/internal/probe"
+	"runstate/engine/internal/proc"
 	"strings"
 	"time"
 )
@@ -18,21 +22,29 @@ const (
 
 // PortInsight contains explanation and status information for a port
 type PortInsight struct {
-	Explanation      string          `json:"explanation"`
-	Icon             string          `json:"icon"` // "docker", "node", "database", etc.
-	Category         ServiceCategory `json:"category"`
-	AgeCategory      string          `json:"age_category"` // "fresh", "lingering", "forgotten"
-	AgeDuration      string          `json:"age_duration"`
-	IsForgotten      bool            `json:"is_forgotten"`
-	ForgottenReasons []string        `json:"forgotten_reasons,omitempty"`
+	Explanation         string          `json:"explanation"`
+	Icon                string          `json:"icon"` // "docker", "node", "database", etc.
+	Category            ServiceCategory `json:"category"`
+	AgeCategory         string          `json:"age_category"` // "fresh", "lingering", "forgotten"
+	AgeDuration         string          `json:"age_duration"`
+	IsForgotten         bool            `json:"is_forgotten"`
+	ForgottenReasons    []string        `json:"forgotten_reasons,omitempty"`
+	ForgottenConfidence float64         `json:"forgotten_confidence"`
+	Confidence          float64         `json:"confidence"`
+	Evidence            []string        `json:"evidence,omitempty"`
+	Probe               *probe.Result   `json:"probe,omitempty"`
 }
 
-// DevToolPatterns maps command patterns to human-readable explanations and icons
-var DevToolPatterns = []struct {
+// DevToolPattern maps a command pattern to a human-readable explanation and icon
+type DevToolPattern struct {
 	Pattern     *regexp.Regexp
 	Explanation string
 	Icon        string
-}{
+}
+
+// DevToolPatterns maps command patterns to human-readable explanations and
+// icons. They are scored alongside ServiceRules by the pattern classifier.
+var DevToolPatterns = []DevToolPattern{
 	// Node.js ecosystem
 	{regexp.MustCompile(`(?i)vite`), "Vite Dev Server", "node"},
 	{regexp.MustCompile(`(?i)webpack`), "Webpack Dev Server", "node"},
@@ -101,6 +113,7 @@ var DevToolPatterns = []struct {
 	{regexp.MustCompile(`(?i)minikube`), "Minikube Cluster", "k8s"},
 	{regexp.MustCompile(`(?i)kubectl`), "Kubernetes CLI", "k8s"},
 	{regexp.MustCompile(`(?i)containerd-shim`), "Container Runtime (Shim)", "docker"},
+	{regexp.MustCompile(`(?i)rootlessport|rootlesskit|slirp4netns|\bpasta\b`), "Rootless Container Port Forwarder", "docker"},
 	{regexp.MustCompile(`(?i)helm\s`), "Helm (K8s)", "k8s"},
 
 	// Message Brokers
@@ -147,40 +160,12 @@ var TerminalPatterns = []string{
 	"wezterm", "iterm", "hyper", "tmux", "screen",
 }
 
-// ExplainProcess generates a human-readable explanation, icon and category for a process
+// ExplainProcess generates a human-readable explanation, icon and category
+// for a process from its command line and name alone. Use ClassifyProcess
+// when more evidence is available.
 func ExplainProcess(cmdline string, name string) (string, string, ServiceCategory) {
-	if cmdline == "" && name == "" {
-		return "System or Container Service", "docker", CategoryDev
-	}
-
-	// Try cmdline first (more specific)
-	for _, pattern := range DevToolPatterns {
-		if pattern.Pattern.MatchString(cmdline) {
-			return pattern.Explanation, pattern.Icon, CategoryDev
-		}
-	}
-
-	// Fallback to process name
-	for _, pattern := range DevToolPatterns {
-		if pattern.Pattern.MatchString(name) {
-			return pattern.Explanation, pattern.Icon, CategoryDev
-		}
-	}
-
-	// Terminal check
-	for _, term := range TerminalPatterns {
-		if strings.Contains(strings.ToLower(cmdline), term) || strings.Contains(strings.ToLower(name), term) {
-			return "Terminal Session", "terminal", CategoryDev
-		}
-	}
-
-	// Generic fallback
-	if name != "" {
-		// Heuristic: if it's a known non-dev system process name, label as system
-		// For now, if not in DevToolPatterns, it's system
-		return "Started by " + name, "system", CategorySystem
-	}
-	return "System Service", "system", CategorySystem
+	c := ClassifyProcess(ClassifyInput{Name: name, Cmdline: cmdline})
+	return c.Explanation, c.Icon, c.Category
 }
 
 // IsDevProcess checks if a process matches any developer tool patterns
@@ -191,6 +176,9 @@ func IsDevProcess(cmdline string, name string) bool {
 
 // IsNoiseProcess returns true if a process is likely irrelevant to the user
 func IsNoiseProcess(cmdline string, name string) bool {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
 	for _, pattern := range NoisePatterns {
 		if pattern.MatchString(cmdline) || pattern.MatchString(name) {
 			return true
@@ -227,41 +215,126 @@ func CategorizeAge(firstSeen time.Time) (category string, duration string) {
 	return category, duration
 }
 
-// IsForgottenPort determines if a port appears to be forgotten
-func IsForgottenPort(firstSeen time.Time, cmdline string, processName string, threshold time.Duration) (bool, []string) {
-	reasons := []string{}
-	age := time.Since(firstSeen)
+// forgottenMinConfidence is the score at which a port is reported forgotten
+const forgottenMinConfidence = 0.5
+
+// devPortRanges are the ranges dev servers usually pick ports from
+var devPortRanges = [][2]int{{3000, 3999}, {4000, 4999}, {5000, 5999}, {8000, 8999}}
 
-	// Criterion 1: Open longer than threshold
+// IsForgottenPort scores how likely a listener is to have been left running
+// by accident. Nothing younger than threshold is forgotten; beyond that the
+// score drops while the terminal or IDE that started the process is open, and
+// grows when it is gone, when the socket has seen no queue activity, and when
+// the port is in a typical dev range. It returns whether the score reaches forgottenMinConfidence, the
+// score itself and the reasons behind it.
+func IsForgottenPort(in ClassifyInput, category ServiceCategory, firstSeen, lastActive time.Time, threshold time.Duration) (bool, float64, []string) {
+	age := time.Since(firstSeen)
 	if age < threshold {
-		return false, nil
+		return false, 0, nil
 	}
-	reasons = append(reasons, fmt.Sprintf("Open for %s (threshold: %s)",
-		formatDuration(age), formatDuration(threshold)))
 
-	// Criterion 2: Parent is IDE/editor (high confidence of forgotten)
-	cmdLower := strings.ToLower(cmdline)
-	nameLower := strings.ToLower(processName)
+	reasons := []string{fmt.Sprintf("Open for %s (threshold: %s)",
+		formatDuration(age), formatDuration(threshold))}
+	score := 0.25
+	if age >= 4*threshold {
+		score += 0.1
+	}
 
-	for _, ide := range IDEPatterns {
-		if strings.Contains(cmdLower, ide) || strings.Contains(nameLower, ide) {
-			reasons = append(reasons, "Spawned by IDE/editor: "+ide)
-			break
-		}
+	// Who started it, judged from the live ancestor chain. A launcher that
+	// is still open means someone can see the process; it outweighs the
+	// idle and dev-port signals.
+	switch launcher, kind := findLauncher(in.Parents); {
+	case kind == "ide":
+		score -= 0.3
+		reasons = append(reasons, fmt.Sprintf("IDE/editor that started it is still open: %s (pid %d)", launcher.Name, launcher.PID))
+	case kind == "terminal":
+		score -= 0.3
+		reasons = append(reasons, fmt.Sprintf("Terminal session that started it is still open: %s (pid %d)", launcher.Name, launcher.PID))
+	case reparented(in.Parents):
+		score += 0.3
+		reasons = append(reasons, fmt.Sprintf("Launching terminal or IDE has exited (re-parented to %s)", in.Parents[0].Name))
+	}
+
+	if in.TTY != "" && !ttyExists(in.TTY) {
+		score += 0.25
+		reasons = append(reasons, "Controlling terminal "+in.TTY+" is gone")
+	}
+
+	// Queue activity on the listening socket
+	idle := time.Since(lastActive)
+	if idle >= threshold {
+		score += 0.25
+		reasons = append(reasons, fmt.Sprintf("No connection activity for %s", formatDuration(idle)))
+	} else if lastActive.After(firstSeen) {
+		score -= 0.2
+		reasons = append(reasons, fmt.Sprintf("Connection activity %s ago", formatDuration(idle)))
 	}
 
-	// Criterion 3: Parent is terminal (medium confidence)
-	for _, term := range TerminalPatterns {
-		if strings.Contains(cmdLower, term) || strings.Contains(nameLower, term) {
-			reasons = append(reasons, "Running in terminal session")
-			break
+	switch {
+	case in.Port > 0 && in.Port < 1024:
+		score -= 0.2
+	case inDevPortRange(in.Port):
+		score += 0.1
+		reasons = append(reasons, fmt.Sprintf("Port %d is in a common dev range", in.Port))
+	}
+
+	if category != CategoryDev {
+		score -= 0.3
+	}
+
+	score = math.Max(0, math.Min(1, score))
+	return score >= forgottenMinConfidence, score, reasons
+}
+
+// findLauncher returns the nearest ancestor that is an IDE or a terminal
+func findLauncher(parents []proc.ProcInfo) (proc.ProcInfo, string) {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	for _, p := range parents {
+		name := strings.ToLower(p.Name)
+		for _, ide := range IDEPatterns {
+			if name == ide {
+				return p, "ide"
+			}
+		}
+		for _, term := range TerminalPatterns {
+			if name == term {
+				return p, "terminal"
+			}
 		}
 	}
+	return proc.ProcInfo{}, ""
+}
 
-	// Criterion 4: Common dev port ranges
-	// This would require port number, handled at call site
+// reparented reports whether a process lost its parent and was adopted by
+// init or a session manager such as systemd --user. Unknown ancestry says
+// nothing either way.
+func reparented(parents []proc.ProcInfo) bool {
+	if len(parents) == 0 {
+		return false
+	}
+	parent := parents[0]
+	return parent.PID == 1 || parent.Name == "systemd" || parent.Name == "init"
+}
 
-	return len(reasons) >= 2, reasons
+// ttyExists checks whether a terminal device is still there. Closing a
+// terminal window releases its pseudo-terminal.
+func ttyExists(tty string) bool {
+	if !strings.HasPrefix(tty, "/dev/") {
+		return true
+	}
+	_, err := os.Stat(tty)
+	return err == nil
+}
+
+func inDevPortRange(port int) bool {
+	for _, r := range devPortRanges {
+		if port >= r[0] && port <= r[1] {
+			return true
+		}
+	}
+	return false
 }
 
 func formatDuration(d time.Duration) string {
@@ -274,11 +347,14 @@ func formatDuration(d time.Duration) string {
 	}
 }
 
-// KnownPorts maps common development ports to their service description and icon
-var KnownPorts = map[int]struct {
+// KnownPort describes the service usually found on a port
+type KnownPort struct {
 	Explanation string
 	Icon        string
-}{
+}
+
+// KnownPorts maps common development ports to their service description and icon
+var KnownPorts = map[int]KnownPort{
 	// Databases
 	5432:  {"PostgreSQL Database", "database"},
 	3306:  {"MySQL Database", "database"},
@@ -307,6 +383,9 @@ var KnownPorts = map[int]struct {
 
 // GenerateInsightFromPort attempts to identify a service based on its port number
 func GenerateInsightFromPort(port int) (string, string, bool) {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
 	if info, ok := KnownPorts[port]; ok {
 		return info.Explanation, info.Icon, true
 	}
@@ -314,18 +393,21 @@ func GenerateInsightFromPort(port int) (string, string, bool) {
 }
 
 // GenerateInsight creates a complete PortInsight for a port
-func GenerateInsight(firstSeen time.Time, cmdline string, processName string, forgottenThreshold time.Duration) *PortInsight {
+func GenerateInsight(firstSeen, lastActive time.Time, in ClassifyInput, forgottenThreshold time.Duration) *PortInsight {
 	categoryAge, duration := CategorizeAge(firstSeen)
-	explanation, icon, category := ExplainProcess(cmdline, processName)
-	isForgotten, reasons := IsForgottenPort(firstSeen, cmdline, processName, forgottenThreshold)
+	c := ClassifyProcess(in)
+	isForgotten, forgottenConfidence, reasons := IsForgottenPort(in, c.Category, firstSeen, lastActive, forgottenThreshold)
 
 	return &PortInsight{
-		Explanation:      explanation,
-		Icon:             icon,
-		Category:         category,
-		AgeCategory:      categoryAge,
-		AgeDuration:      duration,
-		IsForgotten:      isForgotten,
-		ForgottenReasons: reasons,
+		Explanation:         c.Explanation,
+		Icon:                c.Icon,
+		Category:            c.Category,
+		AgeCategory:         categoryAge,
+		AgeDuration:         duration,
+		IsForgotten:         isForgotten,
+		ForgottenReasons:    reasons,
+		ForgottenConfidence: forgottenConfidence,
+		Confidence:          c.Confidence,
+		Evidence:            c.Evidence,
 	}
 }
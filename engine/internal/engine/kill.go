@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// KillResult reports how a termination request ended
+type KillResult struct {
+	Success bool   `json:"success"`
+	Phase   string `json:"phase"`
+	Message string `json:"message"`
+}
+
+// killGrace is how long a process gets to exit after SIGTERM
+const killGrace = 4 * time.Second
+
+// TerminateProcess sends SIGTERM and waits up to 4s for the process to exit
+// before escalating to SIGKILL. With force it goes straight to SIGKILL. Every
+// attempt is recorded via RecordKill.
+func TerminateProcess(pid int32, force bool) KillResult {
+	return terminateBy(pid, force, time.Now().Add(killGrace))
+}
+
+// terminateBy is TerminateProcess with the SIGKILL escalation at deadline,
+// so that several processes can share one grace period
+func terminateBy(pid int32, force bool, deadline time.Time) KillResult {
+	targetProc, err := os.FindProcess(int(pid))
+	if err != nil {
+		return KillResult{Success: false, Phase: "lookup", Message: err.Error()}
+	}
+
+	// Phase 1: SIGTERM
+	if !force {
+		if err := targetProc.Signal(syscall.SIGTERM); err == nil {
+			// Wait for graceful termination
+			for time.Now().Before(deadline) {
+				time.Sleep(min(500*time.Millisecond, time.Until(deadline)))
+				if err := targetProc.Signal(syscall.Signal(0)); err != nil {
+					RecordKill(pid, "sigterm", true)
+					return KillResult{Success: true, Phase: "sigterm", Message: "Terminated gracefully"}
+				}
+			}
+		}
+	}
+
+	// Phase 2: SIGKILL
+	if err := targetProc.Signal(syscall.SIGKILL); err != nil {
+		RecordKill(pid, "sigkill", false)
+		return KillResult{Success: false, Phase: "sigkill", Message: err.Error()}
+	}
+
+	RecordKill(pid, "sigkill", true)
+	return KillResult{Success: true, Phase: "sigkill", Message: "Force terminated"}
+}
+
+// processAlive reports whether pid still exists
+func processAlive(pid int32) bool {
+	return syscall.Kill(int(pid), syscall.Signal(0)) != syscall.ESRCH
+}
@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/* -------------------- kubectl port-forward -------------------- */
+
+// KubeForward is a parsed `kubectl port-forward` command line
+type KubeForward struct {
+	Context   string            `json:"context,omitempty"`
+	Namespace string            `json:"namespace,omitempty"` // "" means the kubeconfig default
+	Resource  string            `json:"resource"`            // e.g. svc/api, pod/web-0
+	Addresses []string          `json:"addresses,omitempty"`
+	Mappings  []KubePortMapping `json:"mappings"`
+}
+
+// KubePortMapping forwards a local port to a port of the resource. Local is 0
+// when kubectl picks a random port (":80"); Remote may be a named port.
+type KubePortMapping struct {
+	Local  int    `json:"local"`
+	Remote string `json:"remote"`
+}
+
+// kubectlCommands are the executables that can run a port-forward
+var kubectlCommands = map[string]bool{"kubectl": true, "oc": true, "minikube": true, "microk8s": true, "k3s": true}
+
+// kubectlValueFlags are global and port-forward flags taking a separate value
+var kubectlValueFlags = map[string]bool{
+	"-n": true, "--namespace": true, "--context": true, "--address": true,
+	"--kubeconfig": true, "--cluster": true, "--user": true, "-s": true, "--server": true,
+	"--as": true, "--as-group": true, "--token": true, "--request-timeout": true,
+	"--pod-running-timeout": true, "-v": true, "--v": true, "--cache-dir": true,
+}
+
+// ParsePortForward recognises `kubectl port-forward` argv, including
+// wrappers such as `minikube kubectl -- port-forward`
+func ParsePortForward(args []string) (*KubeForward, bool) {
+	at := -1
+	for i, a := range args {
+		if a == "port-forward" {
+			at = i
+			break
+		}
+	}
+	if at < 1 {
+		return nil, false
+	}
+	wrapped := false
+	for _, a := range args[:at] {
+		if kubectlCommands[unversioned(commandBase(a))] {
+			wrapped = true
+			break
+		}
+	}
+	if !wrapped {
+		return nil, false
+	}
+
+	kf := &KubeForward{}
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if i == at || (i < at && !strings.HasPrefix(a, "-")) {
+			continue
+		}
+		if a == "--" {
+			continue
+		}
+		if !strings.HasPrefix(a, "-") {
+			positional = append(positional, a)
+			continue
+		}
+
+		name, value, inline := strings.Cut(a, "=")
+		if !inline {
+			if !kubectlValueFlags[name] || i+1 >= len(args) {
+				continue
+			}
+			i++
+			value = args[i]
+		}
+		switch name {
+		case "-n", "--namespace":
+			kf.Namespace = value
+		case "--context":
+			kf.Context = value
+		case "--address":
+			kf.Addresses = append(kf.Addresses, strings.Split(value, ",")...)
+		}
+	}
+
+	if len(positional) < 2 {
+		return nil, false
+	}
+	kf.Resource = positional[0]
+	if !strings.Contains(kf.Resource, "/") {
+		kf.Resource = "pod/" + kf.Resource
+	}
+	for _, spec := range positional[1:] {
+		local, remote, mapped := strings.Cut(spec, ":")
+		if !mapped {
+			remote = local
+		}
+		m := KubePortMapping{Remote: remote}
+		if local != "" {
+			n, err := strconv.Atoi(local)
+			if err != nil {
+				continue
+			}
+			m.Local = n
+		}
+		kf.Mappings = append(kf.Mappings, m)
+	}
+	if len(kf.Mappings) == 0 {
+		return nil, false
+	}
+	return kf, true
+}
+
+// MappingFor returns the mapping serving a local port. A random-port mapping
+// is the fallback, since its local port only shows up once kubectl listens.
+func (kf *KubeForward) MappingFor(port int) (KubePortMapping, bool) {
+	var random *KubePortMapping
+	for i, m := range kf.Mappings {
+		if m.Local == port {
+			return m, true
+		}
+		if m.Local == 0 && random == nil {
+			random = &kf.Mappings[i]
+		}
+	}
+	if random != nil {
+		return KubePortMapping{Local: port, Remote: random.Remote}, true
+	}
+	return KubePortMapping{}, false
+}
+
+// Label describes the forward of one local port, e.g.
+// "port-forward svc/api (ns staging) 8080→80"
+func (kf *KubeForward) Label(port int) string {
+	label := "port-forward " + kf.Resource
+	if kf.Namespace != "" {
+		label += " (ns " + kf.Namespace + ")"
+	}
+	m, ok := kf.MappingFor(port)
+	if !ok {
+		m = kf.Mappings[0]
+	}
+	return fmt.Sprintf("%s %d→%s", label, m.Local, m.Remote)
+}
+
+// classifyPortForward labels kubectl port-forward processes by what they
+// forward. It outranks the plain "Kubernetes CLI" rule.
+func classifyPortForward(in ClassifyInput) []Candidate {
+	kf, ok := ParsePortForward(splitArgs(in))
+	if !ok {
+		return nil
+	}
+	return []Candidate{{
+		Explanation: kf.Label(in.Port),
+		Icon:        "k8s",
+		Category:    CategoryDev,
+		Score:       scoreExecutable + 2*scoreSubcommand,
+		Evidence:    []string{"kubectl port-forward to " + kf.Resource},
+	}}
+}
+
+/* -------------------- local cluster nodes -------------------- */
+
+// ClusterNode is a local Kubernetes node running as a container
+type ClusterNode struct {
+	Distribution string `json:"distribution"` // kind, minikube or k3d
+	Cluster      string `json:"cluster"`
+	Role         string `json:"role,omitempty"` // control-plane, worker, server, agent, loadbalancer
+}
+
+// clusterLabels are the labels each tool puts on its node containers: the
+// cluster name and the node role
+var clusterLabels = []struct {
+	distribution, cluster, role string
+}{
+	{"kind", "io.x-k8s.kind.cluster", "io.x-k8s.kind.role"},
+	{"minikube", "name.minikube.sigs.k8s.io", "role.minikube.sigs.k8s.io"},
+	{"k3d", "k3d.cluster", "k3d.role"},
+}
+
+// Kubernetes NodePort range
+const (
+	nodePortMin = 30000
+	nodePortMax = 32767
+)
+
+// clusterNode recognises kind, minikube and k3d node containers by label
+func clusterNode(labels map[string]string) *ClusterNode {
+	for _, l := range clusterLabels {
+		if name, ok := labels[l.cluster]; ok && name != "" {
+			return &ClusterNode{Distribution: l.distribution, Cluster: name, Role: labels[l.role]}
+		}
+	}
+	return nil
+}
+
+// clusterPortLabel describes a host port published by a cluster node, e.g.
+// "kind cluster dev (control-plane) NodePort 8080→30080"
+func clusterPortLabel(n *ClusterNode, hostPort, containerPort int) string {
+	label := n.Distribution + " cluster " + n.Cluster
+	if n.Role != "" {
+		label += " (" + n.Role + ")"
+	}
+
+	var what string
+	switch {
+	case containerPort == 6443 || (n.Distribution == "minikube" && containerPort == 8443):
+		what = "API server"
+	case containerPort >= nodePortMin && containerPort <= nodePortMax:
+		what = "NodePort"
+	case n.Distribution == "minikube" && containerPort == 22:
+		what = "SSH"
+	case n.Distribution == "minikube" && containerPort == 2376:
+		what = "Docker daemon"
+	case n.Role == "loadbalancer":
+		what = "load balancer"
+	default:
+		what = "hostPort"
+	}
+	return fmt.Sprintf("%s %s %d→%d", label, what, hostPort, containerPort)
+}
@@ -0,0 +1,268 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// engineMetrics holds the counters exported on /metrics
+type engineMetrics struct {
+	mu           sync.Mutex
+	kills        map[[2]string]uint64 // {phase, result} -> count
+	simulations  uint64
+	scans        uint64
+	scanDuration time.Duration
+	lastScan     time.Duration
+}
+
+var metrics = &engineMetrics{kills: make(map[[2]string]uint64)}
+
+// RecordKill counts a kill attempt by termination phase and outcome and
+// publishes it as a kill event
+func RecordKill(pid int32, phase string, success bool) {
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	metrics.mu.Lock()
+	metrics.kills[[2]string{phase, result}]++
+	metrics.mu.Unlock()
+
+	ev := PortEvent{Kind: EventKill, Time: time.Now(), PID: pid, Phase: phase, Success: success}
+	if ps, ok := lastKnownPort(pid); ok {
+		ev.Port = ps.Port
+		ev.Process = ps.Process
+		ev.Project = ps.Project
+		ev.Insight = ps.Insight
+	}
+	publish(ev)
+}
+
+// RecordSimulation counts a kill simulation
+func RecordSimulation() {
+	metrics.mu.Lock()
+	metrics.simulations++
+	metrics.mu.Unlock()
+}
+
+// recordScan accumulates the time spent building a port snapshot
+func recordScan(d time.Duration) {
+	metrics.mu.Lock()
+	metrics.scans++
+	metrics.scanDuration += d
+	metrics.lastScan = d
+	metrics.mu.Unlock()
+}
+
+// WriteMetrics renders the snapshot and engine counters in the Prometheus
+// text exposition format (version 0.0.4).
+func WriteMetrics(w io.Writer, snapshot []PortSnapshot) error {
+	mw := &metricWriter{w: w}
+
+	var forgotten, public int
+	for _, ps := range snapshot {
+		if ps.Insight != nil && ps.Insight.IsForgotten {
+			forgotten++
+		}
+		if hasRisk(ps.Risks, "PUBLIC_EXPOSURE") {
+			public++
+		}
+	}
+
+	mw.header("portwatch_listening_ports", "gauge", "Number of listening TCP ports.")
+	mw.sample("portwatch_listening_ports", nil, float64(len(snapshot)))
+	mw.header("portwatch_forgotten_ports", "gauge", "Number of ports flagged as forgotten.")
+	mw.sample("portwatch_forgotten_ports", nil, float64(forgotten))
+	mw.header("portwatch_public_exposures", "gauge", "Number of dev ports reachable beyond loopback.")
+	mw.sample("portwatch_public_exposures", nil, float64(public))
+
+	mw.header("portwatch_port_info", "gauge", "Listening port metadata; always 1.")
+	for _, ps := range snapshot {
+		mw.sample("portwatch_port_info", portLabels(ps), 1)
+	}
+
+	mw.header("portwatch_port_resident_memory_bytes", "gauge", "Resident memory of the process owning the port.")
+	for _, ps := range snapshot {
+		if ps.Process == nil || ps.PID == 0 {
+			continue
+		}
+		mw.sample("portwatch_port_resident_memory_bytes", portLabels(ps), ps.Process.MemoryMB*1024*1024)
+	}
+
+	mw.header("portwatch_port_age_seconds", "gauge", "Time since the port was first seen by the engine.")
+	for _, ps := range snapshot {
+		mw.sample("portwatch_port_age_seconds", portLabels(ps), time.Since(ps.FirstSeen).Seconds())
+	}
+
+	mw.header("portwatch_port_connections", "gauge", "Established connections accepted on the port.")
+	for _, ps := range snapshot {
+		if ps.Traffic == nil {
+			continue
+		}
+		mw.sample("portwatch_port_connections", portLabels(ps), float64(ps.Traffic.Connections))
+	}
+	mw.header("portwatch_port_accepts_per_second", "gauge", "Connections accepted per second since the previous scan.")
+	for _, ps := range snapshot {
+		if ps.Traffic == nil {
+			continue
+		}
+		mw.sample("portwatch_port_accepts_per_second", portLabels(ps), ps.Traffic.ConnRate)
+	}
+	mw.header("portwatch_port_receive_bytes_per_second", "gauge", "Bytes received per second on accepted connections, where sock_diag is available.")
+	for _, ps := range snapshot {
+		if ps.Traffic == nil || !ps.Traffic.ByteCounters {
+			continue
+		}
+		mw.sample("portwatch_port_receive_bytes_per_second", portLabels(ps), ps.Traffic.BytesInPerSec)
+	}
+	mw.header("portwatch_port_transmit_bytes_per_second", "gauge", "Bytes sent per second on accepted connections, where sock_diag is available.")
+	for _, ps := range snapshot {
+		if ps.Traffic == nil || !ps.Traffic.ByteCounters {
+			continue
+		}
+		mw.sample("portwatch_port_transmit_bytes_per_second", portLabels(ps), ps.Traffic.BytesOutPerSec)
+	}
+
+	mw.header("portwatch_port_accept_queue", "gauge", "Connections waiting for accept() on the listening socket.")
+	for _, ps := range snapshot {
+		if ps.Backlog == nil {
+			continue
+		}
+		mw.sample("portwatch_port_accept_queue", portLabels(ps), float64(ps.Backlog.Queued))
+	}
+	mw.header("portwatch_port_accept_backlog", "gauge", "Accept backlog configured for the listening socket.")
+	for _, ps := range snapshot {
+		if ps.Backlog == nil {
+			continue
+		}
+		mw.sample("portwatch_port_accept_backlog", portLabels(ps), float64(ps.Backlog.Limit))
+	}
+
+	mw.header("portwatch_port_health_up", "gauge", "1 if the last health check of the port passed, 0 otherwise.")
+	for _, ps := range snapshot {
+		if ps.Health == nil {
+			continue
+		}
+		up := 0.0
+		if ps.Health.Healthy {
+			up = 1
+		}
+		mw.sample("portwatch_port_health_up", portLabels(ps), up)
+	}
+	mw.header("portwatch_port_health_latency_seconds", "gauge", "Latency of the last health check of the port.")
+	for _, ps := range snapshot {
+		if ps.Health == nil {
+			continue
+		}
+		mw.sample("portwatch_port_health_latency_seconds", portLabels(ps), ps.Health.Last.LatencyMs/1000)
+	}
+
+	metrics.mu.Lock()
+	kills := make([][2]string, 0, len(metrics.kills))
+	for k := range metrics.kills {
+		kills = append(kills, k)
+	}
+	sort.Slice(kills, func(i, j int) bool {
+		return kills[i][0]+kills[i][1] < kills[j][0]+kills[j][1]
+	})
+
+	mw.header("portwatch_kills_total", "counter", "Kill requests handled, by phase and result.")
+	for _, k := range kills {
+		mw.sample("portwatch_kills_total", []label{{"phase", k[0]}, {"result", k[1]}}, float64(metrics.kills[k]))
+	}
+	mw.header("portwatch_kill_simulations_total", "counter", "Kill simulations performed.")
+	mw.sample("portwatch_kill_simulations_total", nil, float64(metrics.simulations))
+	mw.header("portwatch_scan_duration_seconds", "summary", "Time spent building port snapshots.")
+	mw.sample("portwatch_scan_duration_seconds_sum", nil, metrics.scanDuration.Seconds())
+	mw.sample("portwatch_scan_duration_seconds_count", nil, float64(metrics.scans))
+	mw.header("portwatch_last_scan_duration_seconds", "gauge", "Duration of the most recent snapshot.")
+	mw.sample("portwatch_last_scan_duration_seconds", nil, metrics.lastScan.Seconds())
+	metrics.mu.Unlock()
+
+	return mw.err
+}
+
+type label struct {
+	Name  string
+	Value string
+}
+
+func portLabels(ps PortSnapshot) []label {
+	process, project, category := "", "", ""
+	if ps.Process != nil {
+		process = ps.Process.Name
+	}
+	if ps.Project != nil {
+		project = ps.Project.Name
+	}
+	if ps.Insight != nil {
+		category = string(ps.Insight.Category)
+	}
+	risks := append([]string(nil), ps.Risks...)
+	sort.Strings(risks)
+
+	return []label{
+		{"port", strconv.Itoa(ps.Port)},
+		{"process", process},
+		{"project", project},
+		{"interface", ps.Interface},
+		{"category", category},
+		{"risks", strings.Join(risks, ",")},
+	}
+}
+
+func hasRisk(risks []string, risk string) bool {
+	for _, r := range risks {
+		if r == risk {
+			return true
+		}
+	}
+	return false
+}
+
+// metricWriter writes exposition lines and remembers the first error
+type metricWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (mw *metricWriter) header(name, kind, help string) {
+	mw.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (mw *metricWriter) sample(name string, labels []label, value float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(l.Name)
+			b.WriteString(`="`)
+			b.WriteString(escapeLabel(l.Value))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	mw.printf("%s %s\n", b.String(), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (mw *metricWriter) printf(format string, args ...interface{}) {
+	if mw.err != nil {
+		return
+	}
+	_, mw.err = fmt.Fprintf(mw.w, format, args...)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
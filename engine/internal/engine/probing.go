@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"log"
+	"runstate/engine/internal/probe"
+	"strings"
+	"sync"
+	"time"
+)
+
+// probeRefresh is how long a probe result is trusted for the same listener
+const probeRefresh = 5 * time.Minute
+
+// maxConcurrentProbes bounds background probe goroutines
+const maxConcurrentProbes = 4
+
+type probeCacheEntry struct {
+	firstSeen time.Time
+	result    *probe.Result
+}
+
+var (
+	probeMu      sync.Mutex
+	probeResults = make(map[int]probeCacheEntry)
+	probeRunning = make(map[int]bool)
+	probeSlots   = make(chan struct{}, maxConcurrentProbes)
+)
+
+// probeHost returns the loopback address a listener can be probed on, or ""
+// when the listener is only bound to a non-loopback interface
+func probeHost(ps PortSnapshot) string {
+	switch ps.Interface {
+	case "loopback":
+		return ps.LocalAddr
+	case "any":
+		if strings.Contains(ps.LocalAddr, ":") {
+			return "::1"
+		}
+		return "127.0.0.1"
+	}
+	return ""
+}
+
+// probeListener returns the cached probe result for a listener. Probes run in
+// the background so a snapshot never waits on them; a new result shows up on
+// a later poll.
+func probeListener(ps PortSnapshot) *probe.Result {
+	configMu.RLock()
+	enabled, timeout := ProbeEnabled, ProbeTimeout
+	configMu.RUnlock()
+	if !enabled {
+		return nil
+	}
+
+	host := probeHost(ps)
+	if host == "" {
+		return nil
+	}
+
+	probeMu.Lock()
+	defer probeMu.Unlock()
+
+	cached, ok := probeResults[ps.Port]
+	fresh := ok && cached.firstSeen.Equal(ps.FirstSeen) && time.Since(cached.result.ProbedAt) < probeRefresh
+	if !fresh && !probeRunning[ps.Port] {
+		probeRunning[ps.Port] = true
+		go runProbe(host, ps.Port, ps.FirstSeen, timeout)
+	}
+	if ok && cached.firstSeen.Equal(ps.FirstSeen) {
+		return cached.result
+	}
+	return nil
+}
+
+func runProbe(host string, port int, firstSeen time.Time, timeout time.Duration) {
+	probeSlots <- struct{}{}
+	defer func() { <-probeSlots }()
+
+	res, err := probe.Probe(host, port, timeout)
+
+	probeMu.Lock()
+	defer probeMu.Unlock()
+	delete(probeRunning, port)
+	if err != nil {
+		log.Printf("[probe] port %d: %v", port, err)
+		return
+	}
+	probeResults[port] = probeCacheEntry{firstSeen: firstSeen, result: res}
+}
+
+// applyProbe attaches a probe result to an insight. A recognised protocol is
+// better evidence than a port number, so it also replaces the explanation.
+func applyProbe(insight *PortInsight, res *probe.Result) {
+	if insight == nil || res == nil {
+		return
+	}
+	insight.Probe = res
+	if res.Protocol == "unknown" {
+		return
+	}
+	insight.Explanation = res.Describe()
+	evidence := "probe answered as " + res.Protocol
+	if res.Detail != "" {
+		evidence += " (" + res.Detail + ")"
+	}
+	insight.Evidence = append(insight.Evidence, evidence)
+}
+
+// pruneProbes forgets results for ports no longer listening
+func pruneProbes(open map[int]bool) {
+	probeMu.Lock()
+	defer probeMu.Unlock()
+	for port := range probeResults {
+		if !open[port] {
+			delete(probeResults, port)
+		}
+	}
+}
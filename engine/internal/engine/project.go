@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProjectInfo identifies the project a process is working in
+type ProjectInfo struct {
+	Name string `json:"name"`
+	// Path is the project root: the nearest directory with a manifest, or the
+	// repository root, or the working directory when neither is found.
+	Path string `json:"path"`
+
+	RepoRoot    string `json:"repo_root,omitempty"`
+	Branch      string `json:"branch,omitempty"`
+	Worktree    string `json:"worktree,omitempty"` // set for linked git worktrees
+	Manifest    string `json:"manifest,omitempty"` // e.g. "package.json"
+	PackageName string `json:"package_name,omitempty"`
+}
+
+// projectManifests are checked in order in each directory while walking up
+var projectManifests = []string{"package.json", "go.mod", "Cargo.toml", "pyproject.toml"}
+
+// projectTTL bounds how long a directory lookup is cached; branches change
+const projectTTL = 30 * time.Second
+
+type projectCacheEntry struct {
+	info    *ProjectInfo
+	checked time.Time
+}
+
+var (
+	projectMu    sync.Mutex
+	projectCache = make(map[string]projectCacheEntry)
+)
+
+/* -------------------- project identification -------------------- */
+
+// getProjectInfo resolves the project for a working directory, caching the
+// result per directory
+func getProjectInfo(cwd string) *ProjectInfo {
+	if cwd == "" {
+		return nil
+	}
+	now := time.Now()
+
+	projectMu.Lock()
+	if e, ok := projectCache[cwd]; ok && now.Sub(e.checked) < projectTTL {
+		projectMu.Unlock()
+		return e.info
+	}
+	projectMu.Unlock()
+
+	info := resolveProject(cwd)
+
+	projectMu.Lock()
+	projectCache[cwd] = projectCacheEntry{info: info, checked: now}
+	for dir, e := range projectCache {
+		if now.Sub(e.checked) >= projectTTL {
+			delete(projectCache, dir)
+		}
+	}
+	projectMu.Unlock()
+
+	return info
+}
+
+func resolveProject(cwd string) *ProjectInfo {
+	info := &ProjectInfo{}
+
+	dir := filepath.Clean(cwd)
+	for {
+		if info.Manifest == "" {
+			for _, m := range projectManifests {
+				if name, ok := readManifestName(filepath.Join(dir, m)); ok {
+					info.Path = dir
+					info.Manifest = m
+					info.PackageName = name
+					break
+				}
+			}
+		}
+
+		if fi, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			info.RepoRoot = dir
+			gitDir := filepath.Join(dir, ".git")
+			if !fi.IsDir() {
+				// .git is a file pointing at the real git dir in linked
+				// worktrees (.git/worktrees/<name>) and in submodules
+				// (.git/modules/<name>); only worktrees are separate checkouts
+				gitDir = readGitDirFile(gitDir)
+				if strings.Contains(filepath.ToSlash(gitDir), "/worktrees/") {
+					info.Worktree = filepath.Base(dir)
+				}
+			}
+			info.Branch = readGitBranch(gitDir)
+			break
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	switch {
+	case info.PackageName != "":
+		info.Name = path.Base(info.PackageName)
+		// Keep npm scopes, "@acme/web" reads better than "web"
+		if strings.HasPrefix(info.PackageName, "@") {
+			info.Name = info.PackageName
+		}
+	case info.Path != "":
+		info.Name = filepath.Base(info.Path)
+	case info.RepoRoot != "":
+		info.Path = info.RepoRoot
+		info.Name = filepath.Base(info.RepoRoot)
+	default:
+		return fallbackProjectInfo(cwd)
+	}
+
+	// Different checkouts of one repo share a package name; tell them apart
+	if info.Worktree != "" {
+		info.Name += "@" + info.Worktree
+	}
+
+	return info
+}
+
+// fallbackProjectInfo names a directory outside any repo or package by its
+// last path segment, skipping generic build directory names
+func fallbackProjectInfo(cwd string) *ProjectInfo {
+	parts := strings.Split(strings.TrimRight(cwd, "/"), "/")
+	name := parts[len(parts)-1]
+	if name == "" {
+		return nil
+	}
+	if name == "src" || name == "app" || name == "build" || name == "dist" {
+		if len(parts) > 1 && parts[len(parts)-2] != "" {
+			name = parts[len(parts)-2] + "/" + name
+		}
+	}
+
+	return &ProjectInfo{
+		Name: name,
+		Path: cwd,
+	}
+}
+
+/* -------------------- manifests -------------------- */
+
+// readManifestName reports whether the manifest exists and returns the
+// package name it declares, which may be empty
+func readManifestName(file string) (string, bool) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", false
+	}
+
+	switch filepath.Base(file) {
+	case "package.json":
+		var pkg struct {
+			Name string `json:"name"`
+		}
+		json.Unmarshal(data, &pkg)
+		return pkg.Name, true
+	case "go.mod":
+		for _, line := range strings.Split(string(data), "\n") {
+			if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+				return strings.Trim(strings.TrimSpace(rest), `"`), true
+			}
+		}
+		return "", true
+	case "Cargo.toml":
+		return tomlName(data, "package"), true
+	case "pyproject.toml":
+		if name := tomlName(data, "project"); name != "" {
+			return name, true
+		}
+		return tomlName(data, "tool.poetry"), true
+	}
+	return "", true
+}
+
+// tomlName extracts `name = "..."` from a table. It only understands the flat
+// key/value layout manifests use, which is all that is needed here.
+func tomlName(data []byte, table string) string {
+	inTable := false
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inTable = strings.Trim(line, "[] ") == table
+			continue
+		}
+		if !inTable {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if found && strings.TrimSpace(key) == "name" {
+			return strings.Trim(strings.TrimSpace(value), `"'`)
+		}
+	}
+	return ""
+}
+
+/* -------------------- git -------------------- */
+
+// readGitDirFile follows a worktree's "gitdir: <path>" file
+func readGitDirFile(file string) string {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	dir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return ""
+	}
+	dir = strings.TrimSpace(dir)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(file), dir)
+	}
+	return dir
+}
+
+// readGitBranch returns the checked-out branch, or the short commit hash for
+// a detached HEAD
+func readGitBranch(gitDir string) string {
+	if gitDir == "" {
+		return ""
+	}
+	data, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	head := strings.TrimSpace(string(data))
+	if ref, ok := strings.CutPrefix(head, "ref: "); ok {
+		return strings.TrimPrefix(ref, "refs/heads/")
+	}
+	if len(head) >= 7 {
+		return head[:7]
+	}
+	return head
+}
@@ -0,0 +1,309 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"runstate/engine/internal/config"
+	"runstate/engine/internal/proc"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProjectGroup aggregates everything running on behalf of one project
+type ProjectGroup struct {
+	Project       ProjectInfo     `json:"project"`
+	Processes     []proc.ProcInfo `json:"processes"`
+	Ports         []int           `json:"ports"`
+	TotalMemoryMB float64         `json:"total_memory_mb"`
+	StartedAt     time.Time       `json:"started_at"`
+	AgeDuration   string          `json:"age_duration"`
+}
+
+// ProjectKillSimulation is the combined impact of stopping a whole project
+type ProjectKillSimulation struct {
+	Project         ProjectInfo      `json:"project"`
+	Members         []KillSimulation `json:"members"`
+	AffectedPorts   []int            `json:"affected_ports"`
+	IsProtected     bool             `json:"is_protected"`
+	ProtectedReason string           `json:"protected_reason,omitempty"`
+	Warnings        []string         `json:"warnings"`
+}
+
+// ProjectStopResult reports the outcome for each member of a project stop
+type ProjectStopResult struct {
+	Project ProjectInfo          `json:"project"`
+	Results map[int32]KillResult `json:"results"`
+	Skipped map[int32]string     `json:"skipped,omitempty"`
+}
+
+// projectOwner is the user who launched the engine. The engine runs as root,
+// so on a shared checkout only this user's processes form projects that
+// /projects/stop may signal. Empty when unknown, which matches nobody.
+var projectOwner = sync.OnceValue(func() string {
+	u, err := config.InvokingUser()
+	if err != nil {
+		log.Printf("[projects] invoking user unknown, projects will be empty: %v", err)
+		return ""
+	}
+	return u.Username
+})
+
+// GroupProjects groups listeners and the dev processes working in the same
+// project. Members are the owners of listening ports, other dev tools whose
+// working directory resolves to the project (watchers, workers), and all
+// their descendants, as long as they belong to projectOwner. Shells and
+// editors are never members.
+func GroupProjects(processes map[int32]proc.ProcInfo, ports []PortSnapshot) []ProjectGroup {
+	groups := make(map[string]*ProjectGroup)
+	members := make(map[string]map[int32]bool)
+	owner := projectOwner()
+	owned := func(pid int32) bool {
+		p, ok := processes[pid]
+		return ok && owner != "" && p.Username == owner
+	}
+
+	add := func(project *ProjectInfo, pid int32) {
+		key := project.Path
+		g, ok := groups[key]
+		if !ok {
+			g = &ProjectGroup{Project: *project}
+			groups[key] = g
+			members[key] = make(map[int32]bool)
+		}
+		members[key][pid] = true
+	}
+
+	for _, ps := range ports {
+		if ps.Project == nil || ps.PID <= 0 {
+			continue
+		}
+		if owned(ps.PID) {
+			add(ps.Project, ps.PID)
+		}
+	}
+
+	for pid, p := range processes {
+		if !owned(pid) || !isProjectMember(p) {
+			continue
+		}
+		if project := getProjectInfo(p.Cwd); project != nil {
+			if _, ok := groups[project.Path]; ok {
+				add(project, pid)
+			}
+		}
+	}
+
+	out := make([]ProjectGroup, 0, len(groups))
+	for key, g := range groups {
+		for pid := range members[key] {
+			for _, child := range GetChildProcesses(pid, processes) {
+				if owned(child.PID) {
+					members[key][child.PID] = true
+				}
+			}
+		}
+
+		for pid := range members[key] {
+			p := processes[pid]
+			g.Processes = append(g.Processes, p)
+			g.TotalMemoryMB += p.MemoryMB
+			if g.StartedAt.IsZero() || p.CreateTime.Before(g.StartedAt) {
+				g.StartedAt = p.CreateTime
+			}
+		}
+		sort.Slice(g.Processes, func(i, j int) bool { return g.Processes[i].PID < g.Processes[j].PID })
+
+		g.Ports = []int{}
+		for _, ps := range ports {
+			if members[key][ps.PID] {
+				g.Ports = append(g.Ports, ps.Port)
+			}
+		}
+		sort.Ints(g.Ports)
+		_, g.AgeDuration = CategorizeAge(g.StartedAt)
+
+		out = append(out, *g)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Project.Name < out[j].Project.Name })
+	return out
+}
+
+// isProjectMember excludes the interactive tools a developer works in from
+// project membership, so a project stop never takes down a shell or editor
+func isProjectMember(p proc.ProcInfo) bool {
+	explanation, _, category := ExplainProcess(p.Cmdline, p.Name)
+	if category != CategoryDev || explanation == "Terminal Session" {
+		return false
+	}
+
+	configMu.RLock()
+	defer configMu.RUnlock()
+	name := strings.ToLower(p.Name)
+	for _, ide := range IDEPatterns {
+		if name == ide {
+			return false
+		}
+	}
+	for _, term := range TerminalPatterns {
+		if name == term {
+			return false
+		}
+	}
+	return true
+}
+
+// FindProjectGroup looks a project up by root path or name
+func FindProjectGroup(groups []ProjectGroup, key string) (ProjectGroup, bool) {
+	for _, g := range groups {
+		if g.Project.Path == key {
+			return g, true
+		}
+	}
+	for _, g := range groups {
+		if g.Project.Name == key {
+			return g, true
+		}
+	}
+	return ProjectGroup{}, false
+}
+
+// SimulateProjectKill runs SimulateKill for every member of a project and
+// merges the results
+func SimulateProjectKill(group ProjectGroup, processes map[int32]proc.ProcInfo, ports []PortSnapshot) ProjectKillSimulation {
+	sim := ProjectKillSimulation{
+		Project:       group.Project,
+		Members:       []KillSimulation{},
+		AffectedPorts: []int{},
+		Warnings:      []string{},
+	}
+
+	inProject := make(map[int32]bool, len(group.Processes))
+	for _, p := range group.Processes {
+		inProject[p.PID] = true
+	}
+
+	portSeen := make(map[int]bool)
+	warnSeen := make(map[string]bool)
+	for _, p := range group.Processes {
+		member := SimulateKill(p.PID, processes, ports)
+		sim.Members = append(sim.Members, member)
+
+		for _, port := range member.AffectedPorts {
+			if !portSeen[port] {
+				portSeen[port] = true
+				sim.AffectedPorts = append(sim.AffectedPorts, port)
+			}
+		}
+		if member.IsProtected && !sim.IsProtected {
+			sim.IsProtected = true
+			sim.ProtectedReason = fmt.Sprintf("%s (pid %d): %s", p.Name, p.PID, member.ProtectedReason)
+		}
+		for _, w := range member.Warnings {
+			// Parent and child warnings about other members are expected here
+			if strings.HasPrefix(w, "Will terminate") {
+				continue
+			}
+			if parent, ok := processes[p.PPID]; ok && inProject[parent.PID] && strings.HasPrefix(w, "Parent process") {
+				continue
+			}
+			msg := fmt.Sprintf("%s (pid %d): %s", p.Name, p.PID, w)
+			if !warnSeen[msg] {
+				warnSeen[msg] = true
+				sim.Warnings = append(sim.Warnings, msg)
+			}
+		}
+		for _, child := range member.ChildProcesses {
+			if !inProject[child.PID] {
+				msg := fmt.Sprintf("%s (pid %d) is not part of the project but will be terminated", child.Name, child.PID)
+				if !warnSeen[msg] {
+					warnSeen[msg] = true
+					sim.Warnings = append(sim.Warnings, msg)
+				}
+			}
+		}
+	}
+	sort.Ints(sim.AffectedPorts)
+
+	return sim
+}
+
+// supervisorHeadStart is how long supervisors get to exit before their
+// workers are signalled, so that they do not respawn them
+const supervisorHeadStart = time.Second
+
+// StopProject terminates every member of a project, with the same SIGTERM
+// then SIGKILL sequence as a single kill. Protected members are skipped
+// unless includeProtected is set. Members with children (nodemon, compose,
+// foreman) are signalled first so they cannot respawn their workers; the
+// remaining members follow in parallel. All share one grace period.
+func StopProject(sim ProjectKillSimulation, force bool, includeProtected bool) ProjectStopResult {
+	res := ProjectStopResult{
+		Project: sim.Project,
+		Results: make(map[int32]KillResult),
+		Skipped: make(map[int32]string),
+	}
+
+	var supervisors, workers []KillSimulation
+	for _, m := range sim.Members {
+		switch {
+		case m.IsProtected && !includeProtected:
+			res.Skipped[m.TargetPID] = m.ProtectedReason
+		case !processAlive(m.TargetPID):
+			res.Skipped[m.TargetPID] = "Process already exited"
+		case len(m.ChildProcesses) > 0:
+			supervisors = append(supervisors, m)
+		default:
+			workers = append(workers, m)
+		}
+	}
+
+	deadline := time.Now().Add(killGrace)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	terminate := func(members []KillSimulation) {
+		for _, m := range members {
+			wg.Add(1)
+			go func(pid int32) {
+				defer wg.Done()
+				r := terminateBy(pid, force, deadline)
+				mu.Lock()
+				res.Results[pid] = r
+				mu.Unlock()
+			}(m.TargetPID)
+		}
+	}
+
+	terminate(supervisors)
+	if len(supervisors) > 0 {
+		headStart := time.Now().Add(supervisorHeadStart)
+		for time.Now().Before(headStart) && anyAlive(supervisors) {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	// Workers a supervisor took down with it need no signal
+	var remaining []KillSimulation
+	for _, m := range workers {
+		if processAlive(m.TargetPID) {
+			remaining = append(remaining, m)
+		} else {
+			res.Skipped[m.TargetPID] = "Exited with its supervisor"
+		}
+	}
+	terminate(remaining)
+	wg.Wait()
+
+	return res
+}
+
+func anyAlive(members []KillSimulation) bool {
+	for _, m := range members {
+		if processAlive(m.TargetPID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,563 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"runstate/engine/internal/proc"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyConfigTTL is how long a parsed reverse proxy config is reused. Proxies
+// reload in place, so the PID alone doesn't say when the config changed.
+const proxyConfigTTL = 30 * time.Second
+
+// maxIncludeDepth bounds nested include directives
+const maxIncludeDepth = 8
+
+type proxyConfigKey struct {
+	pid        int32
+	createTime int64
+	path       string
+}
+
+type proxyConfig struct {
+	parsedAt  time.Time
+	upstreams map[int][]ForwardTarget
+}
+
+var (
+	proxyConfigMu sync.Mutex
+	proxyConfigs  = make(map[proxyConfigKey]*proxyConfig)
+)
+
+// proxyUpstreams returns the upstreams per listening port from a proxy's
+// config file, parsing it at most once per proxyConfigTTL
+func proxyUpstreams(info proc.ProcInfo, path string, parse func(string) map[int][]ForwardTarget) map[int][]ForwardTarget {
+	if path == "" {
+		return nil
+	}
+	key := proxyConfigKey{info.PID, info.CreateTime.UnixMilli(), path}
+	now := time.Now()
+
+	proxyConfigMu.Lock()
+	defer proxyConfigMu.Unlock()
+	if c, ok := proxyConfigs[key]; ok && now.Sub(c.parsedAt) < proxyConfigTTL {
+		return c.upstreams
+	}
+	for k, c := range proxyConfigs {
+		if now.Sub(c.parsedAt) >= proxyConfigTTL {
+			delete(proxyConfigs, k)
+		}
+	}
+	upstreams := parse(path)
+	proxyConfigs[key] = &proxyConfig{parsedAt: now, upstreams: upstreams}
+	return upstreams
+}
+
+// resolvePath makes a config path from argv absolute against the process's
+// working directory
+func resolvePath(path, cwd string) string {
+	if path == "" || filepath.IsAbs(path) || cwd == "" {
+		return path
+	}
+	return filepath.Join(cwd, path)
+}
+
+/* -------------------- nginx -------------------- */
+
+// nginxDefaultConfig is where distribution packages put the main config
+const nginxDefaultConfig = "/etc/nginx/nginx.conf"
+
+// nginxPassDirectives hand a request to a backend
+var nginxPassDirectives = map[string]string{
+	"proxy_pass":   "80",
+	"grpc_pass":    "80",
+	"fastcgi_pass": "",
+	"uwsgi_pass":   "",
+	"scgi_pass":    "",
+}
+
+// nginxConfigPath finds the config of an nginx master process. The master
+// rewrites its argv to "nginx: master process /usr/sbin/nginx -c ...", so
+// flags are read from the words of the command line.
+func nginxConfigPath(info proc.ProcInfo) string {
+	words := strings.Fields(info.Cmdline)
+	prefix, conf := "", ""
+	for i := 0; i < len(words); i++ {
+		switch w := words[i]; {
+		case w == "-c" && i+1 < len(words):
+			i++
+			conf = words[i]
+		case strings.HasPrefix(w, "-c") && len(w) > 2:
+			conf = w[2:]
+		case w == "-p" && i+1 < len(words):
+			i++
+			prefix = words[i]
+		}
+	}
+	switch {
+	case conf != "" && prefix != "" && !filepath.IsAbs(conf):
+		return filepath.Join(prefix, conf)
+	case conf != "":
+		return resolvePath(conf, info.Cwd)
+	case prefix != "":
+		return filepath.Join(prefix, "conf", "nginx.conf")
+	}
+	return nginxDefaultConfig
+}
+
+// nginxTokens splits an nginx config into words and the ; { } punctuation,
+// expanding include directives in place
+func nginxTokens(path string, depth int) []string {
+	data, err := os.ReadFile(path)
+	if err != nil || depth > maxIncludeDepth {
+		return nil
+	}
+
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	var quote byte
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			flush()
+		case c == ';' || c == '{' || c == '}':
+			flush()
+			tokens = append(tokens, string(c))
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush()
+		default:
+			word.WriteByte(c)
+		}
+	}
+	flush()
+
+	// Includes are relative to the directory of the main config
+	var out []string
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i] == "include" && i+2 < len(tokens) && tokens[i+2] == ";" && (i == 0 || isNginxStatementEnd(tokens[i-1])) {
+			pattern := tokens[i+1]
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(path), pattern)
+			}
+			matches, _ := filepath.Glob(pattern)
+			for _, m := range matches {
+				out = append(out, nginxTokens(m, depth+1)...)
+			}
+			i += 2
+			continue
+		}
+		out = append(out, tokens[i])
+	}
+	return out
+}
+
+func isNginxStatementEnd(tok string) bool {
+	return tok == ";" || tok == "{" || tok == "}"
+}
+
+// parseNginxConfig maps the listen ports of every server block, http or
+// stream, to the backends its pass directives point at
+func parseNginxConfig(path string) map[int][]ForwardTarget {
+	tokens := nginxTokens(path, 0)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	type server struct {
+		listens []int
+		passes  []string // "scheme://host:port" or "host:port"
+		defPort []string
+	}
+	var servers []*server
+	upstreams := make(map[string][]string)
+
+	var stack []string // enclosing block names
+	var current *server
+	upstream := ""
+	var stmt []string
+	for _, tok := range tokens {
+		switch tok {
+		case "{":
+			name := ""
+			if len(stmt) > 0 {
+				name = stmt[0]
+			}
+			stack = append(stack, name)
+			// "server" inside an upstream is a directive, not a block
+			switch {
+			case name == "server" && current == nil:
+				current = &server{}
+				servers = append(servers, current)
+			case name == "upstream" && len(stmt) > 1:
+				upstream = stmt[1]
+			}
+			stmt = nil
+		case "}":
+			if len(stack) > 0 {
+				switch stack[len(stack)-1] {
+				case "server":
+					current = nil
+				case "upstream":
+					upstream = ""
+				}
+				stack = stack[:len(stack)-1]
+			}
+			stmt = nil
+		case ";":
+			switch {
+			case len(stmt) < 2:
+			case upstream != "" && stmt[0] == "server":
+				upstreams[upstream] = append(upstreams[upstream], stmt[1])
+			case current != nil && stmt[0] == "listen":
+				if port, ok := nginxListenPort(stmt[1]); ok {
+					current.listens = append(current.listens, port)
+				}
+			case current != nil:
+				if def, ok := nginxPassDirectives[stmt[0]]; ok {
+					current.passes = append(current.passes, stmt[1])
+					current.defPort = append(current.defPort, def)
+				}
+			}
+			stmt = nil
+		default:
+			stmt = append(stmt, tok)
+		}
+	}
+
+	out := make(map[int][]ForwardTarget)
+	for _, s := range servers {
+		listens := s.listens
+		if len(listens) == 0 {
+			// nginx listens on *:80 when a server has no listen directive
+			listens = []int{80}
+		}
+		var targets []ForwardTarget
+		seen := make(map[string]bool)
+		for i, pass := range s.passes {
+			for _, t := range nginxTargets(pass, s.defPort[i], upstreams) {
+				if !seen[t.Target] {
+					seen[t.Target] = true
+					targets = append(targets, t)
+				}
+			}
+		}
+		for _, port := range listens {
+			out[port] = append(out[port], targets...)
+		}
+	}
+	return out
+}
+
+// nginxListenPort reads the port of a listen directive: "80", "*:8080",
+// "127.0.0.1:8080" or "[::]:443". Unix sockets have none.
+func nginxListenPort(addr string) (int, bool) {
+	if strings.HasPrefix(addr, "unix:") {
+		return 0, false
+	}
+	if _, port, ok := splitHostPort(addr); ok {
+		return port, true
+	}
+	if i := strings.LastIndexByte(addr, ':'); i >= 0 {
+		port, err := strconv.Atoi(addr[i+1:])
+		return port, err == nil
+	}
+	// A bare address listens on 80
+	return 80, true
+}
+
+// nginxTargets resolves a pass directive argument, expanding upstream groups
+func nginxTargets(pass, defPort string, upstreams map[string][]string) []ForwardTarget {
+	// Targets built from variables are only known per request
+	if strings.Contains(pass, "$") || strings.HasPrefix(pass, "unix:") {
+		return nil
+	}
+	addr := pass
+	if scheme, rest, ok := strings.Cut(pass, "://"); ok {
+		addr = rest
+		if scheme == "https" || scheme == "grpcs" {
+			defPort = "443"
+		}
+	}
+	addr, _, _ = strings.Cut(addr, "/")
+
+	if servers, ok := upstreams[addr]; ok {
+		var out []ForwardTarget
+		for _, s := range servers {
+			if !strings.HasPrefix(s, "unix:") {
+				out = append(out, hostPortTarget("nginx", s, "80"))
+			}
+		}
+		return out
+	}
+	return []ForwardTarget{hostPortTarget("nginx", addr, defPort)}
+}
+
+// hostPortTarget builds a target from "host[:port]", applying defPort when
+// the port is omitted
+func hostPortTarget(via, addr, defPort string) ForwardTarget {
+	t := ForwardTarget{Via: via, Target: addr}
+	if host, port, ok := splitHostPort(addr); ok {
+		t.Host, t.Port = host, port
+		if host == "" {
+			t.Host = "localhost"
+			t.Target = "localhost:" + strconv.Itoa(port)
+		}
+		return t
+	}
+	t.Host = strings.Trim(addr, "[]")
+	if defPort != "" {
+		t.Port, _ = strconv.Atoi(defPort)
+		t.Target = addr + ":" + defPort
+	}
+	return t
+}
+
+/* -------------------- caddy -------------------- */
+
+// caddyfilePath finds the Caddyfile a caddy process runs with. JSON configs
+// are not read.
+func caddyfilePath(info proc.ProcInfo) string {
+	args := info.Args
+	config, adapter := "", ""
+	running := false
+	for i := 1; i < len(args); i++ {
+		name, value, inline := strings.Cut(args[i], "=")
+		switch name {
+		case "run", "start":
+			running = true
+			continue
+		case "--config", "-c", "--adapter", "-a":
+		default:
+			continue
+		}
+		if !inline && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		if name == "--adapter" || name == "-a" {
+			adapter = value
+		} else {
+			config = value
+		}
+	}
+	if config == "" {
+		if !running {
+			return ""
+		}
+		// caddy run picks up a Caddyfile in its working directory
+		config = "Caddyfile"
+	}
+	if adapter != "" && adapter != "caddyfile" {
+		return ""
+	}
+	if adapter == "" && strings.HasSuffix(config, ".json") {
+		return ""
+	}
+	return resolvePath(config, info.Cwd)
+}
+
+// parseCaddyReverseProxy reads `caddy reverse-proxy --from ... --to ...`
+func parseCaddyReverseProxy(args []string) (map[int][]ForwardTarget, bool) {
+	at := -1
+	for i, a := range args {
+		if a == "reverse-proxy" {
+			at = i
+			break
+		}
+	}
+	if at < 0 {
+		return nil, false
+	}
+
+	from := ""
+	var to []string
+	for i := at + 1; i < len(args); i++ {
+		name, value, inline := strings.Cut(args[i], "=")
+		if name != "--from" && name != "-f" && name != "--to" && name != "-t" {
+			continue
+		}
+		if !inline && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		if name == "--from" || name == "-f" {
+			from = value
+		} else {
+			to = append(to, value)
+		}
+	}
+
+	port := 443
+	if from != "" {
+		port = caddySitePort(from)
+	}
+	out := make(map[int][]ForwardTarget)
+	for _, u := range to {
+		out[port] = append(out[port], caddyUpstream(u))
+	}
+	return out, true
+}
+
+// caddySitePort is the port a Caddyfile site address is served on. Caddy
+// serves HTTPS, even for localhost, unless the address says otherwise.
+func caddySitePort(addr string) int {
+	scheme, rest, hasScheme := strings.Cut(addr, "://")
+	if !hasScheme {
+		rest = addr
+	}
+	rest, _, _ = strings.Cut(rest, "/")
+	if _, port, ok := splitHostPort(rest); ok {
+		return port
+	}
+	if i := strings.LastIndexByte(rest, ':'); i >= 0 && !strings.Contains(rest[i:], "]") {
+		if port, err := strconv.Atoi(rest[i+1:]); err == nil {
+			return port
+		}
+	}
+	if hasScheme && scheme == "http" {
+		return 80
+	}
+	return 443
+}
+
+// caddyUpstream parses a reverse_proxy upstream: "localhost:3000",
+// "http://app:8080", ":9000"
+func caddyUpstream(u string) ForwardTarget {
+	def := "80"
+	if scheme, rest, ok := strings.Cut(u, "://"); ok {
+		u = rest
+		if scheme == "https" {
+			def = "443"
+		}
+	}
+	u, _, _ = strings.Cut(u, "/")
+	return hostPortTarget("caddy", u, def)
+}
+
+// caddyLines splits a Caddyfile into lines of tokens, with braces as tokens
+// of their own
+func caddyLines(path string) [][]string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var lines [][]string
+	for _, raw := range strings.Split(string(data), "\n") {
+		var line []string
+		for _, f := range strings.Fields(raw) {
+			if strings.HasPrefix(f, "#") {
+				break
+			}
+			switch {
+			case f == "{" || f == "}":
+				line = append(line, f)
+			case strings.HasSuffix(f, "{") && !strings.Contains(f, "{$"):
+				line = append(line, strings.TrimSuffix(f, "{"), "{")
+			default:
+				line = append(line, f)
+			}
+		}
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// parseCaddyfile maps site ports to their reverse_proxy upstreams. Snippets,
+// imports and named matchers are not expanded.
+func parseCaddyfile(path string) map[int][]ForwardTarget {
+	lines := caddyLines(path)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	out := make(map[int][]ForwardTarget)
+	var sitePorts []int
+	addUpstreams := func(args []string) {
+		for _, a := range args {
+			// Matchers come before the upstreams
+			if strings.HasPrefix(a, "/") || strings.HasPrefix(a, "@") || a == "*" || strings.Contains(a, "{") {
+				continue
+			}
+			t := caddyUpstream(a)
+			for _, port := range sitePorts {
+				out[port] = append(out[port], t)
+			}
+		}
+	}
+
+	depth := 0
+	proxyDepth := -1 // depth of the open reverse_proxy block, if any
+	bare := false    // a Caddyfile with a single site may leave out the braces
+	for _, line := range lines {
+		opens := line[len(line)-1] == "{"
+		if line[0] == "}" {
+			depth--
+			if depth <= proxyDepth {
+				proxyDepth = -1
+			}
+			continue
+		}
+
+		if depth == 0 && !bare {
+			// Global options and snippets have no address
+			if line[0] == "{" || strings.HasPrefix(line[0], "(") {
+				if opens {
+					depth++
+				}
+				continue
+			}
+			sitePorts = nil
+			for _, a := range line {
+				for _, addr := range strings.Split(a, ",") {
+					if addr != "" && addr != "{" {
+						sitePorts = append(sitePorts, caddySitePort(addr))
+					}
+				}
+			}
+			if opens {
+				depth++
+			} else {
+				bare = true
+			}
+			continue
+		}
+
+		switch {
+		case line[0] == "reverse_proxy" && proxyDepth < 0:
+			addUpstreams(line[1:])
+			if opens {
+				proxyDepth = depth
+			}
+		case line[0] == "to" && proxyDepth >= 0:
+			addUpstreams(line[1:])
+		}
+		if opens {
+			depth++
+		}
+	}
+	return out
+}
@@ -0,0 +1,356 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PortQuery describes the filters, ordering and paging applied to a port snapshot
+type PortQuery struct {
+	Interfaces []string
+	Categories []string
+	Risks      []string
+	Usernames  []string
+	Projects   []string
+	MinPort    int
+	MaxPort    int
+	Forgotten  *bool
+
+	SortBy   string
+	SortDesc bool
+	Fields   []string
+
+	Offset int
+	Limit  int
+}
+
+// sortKeys lists the fields /ports can be ordered by
+var sortKeys = map[string]bool{
+	"port": true, "pid": true, "process": true, "project": true,
+	"interface": true, "category": true, "age": true, "memory": true,
+}
+
+// portFields lists the JSON fields of a PortSnapshot that fields= may select
+var portFields = jsonFields(reflect.TypeOf(PortSnapshot{}))
+
+// jsonFields returns the names encoding/json uses for the fields of t,
+// including those promoted from embedded structs
+func jsonFields(t reflect.Type) map[string]bool {
+	out := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch {
+		case name == "-" || (!f.IsExported() && !f.Anonymous):
+		case name == "" && f.Anonymous && f.Type.Kind() == reflect.Struct:
+			for k := range jsonFields(f.Type) {
+				out[k] = true
+			}
+		case name == "":
+			out[f.Name] = true
+		default:
+			out[name] = true
+		}
+	}
+	return out
+}
+
+// ParsePortQuery builds a PortQuery from URL query parameters.
+//
+// Supported parameters:
+//
+//	interface=loopback,any   category=dev   risk=PUBLIC_EXPOSURE
+//	user=alice               project=api    port=3000-3999 (or port=5432)
+//	forgotten=true           sort=-memory   fields=port,pid,process
+//	offset=0                 limit=50
+//
+// List parameters accept comma-separated values and may be repeated.
+func ParsePortQuery(values url.Values) (PortQuery, error) {
+	q := PortQuery{
+		Interfaces: listParam(values, "interface"),
+		Categories: listParam(values, "category"),
+		Risks:      listParam(values, "risk"),
+		Usernames:  listParam(values, "user"),
+		Projects:   listParam(values, "project"),
+		Fields:     listParam(values, "fields"),
+		SortBy:     "port",
+	}
+
+	for _, iface := range q.Interfaces {
+		switch iface {
+		case "loopback", "any", "private", "public", "unknown":
+		default:
+			return q, fmt.Errorf("invalid interface %q", iface)
+		}
+	}
+
+	for _, f := range q.Fields {
+		if !portFields[f] {
+			return q, fmt.Errorf("invalid field %q", f)
+		}
+	}
+
+	if r := values.Get("port"); r != "" {
+		lo, hi, found := strings.Cut(r, "-")
+		min, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return q, fmt.Errorf("invalid port range %q", r)
+		}
+		max := min
+		if found {
+			if max, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+				return q, fmt.Errorf("invalid port range %q", r)
+			}
+		}
+		if min < 1 || max > 65535 || min > max {
+			return q, fmt.Errorf("invalid port range %q", r)
+		}
+		q.MinPort, q.MaxPort = min, max
+	}
+
+	if f := values.Get("forgotten"); f != "" {
+		b, err := strconv.ParseBool(f)
+		if err != nil {
+			return q, fmt.Errorf("invalid forgotten value %q", f)
+		}
+		q.Forgotten = &b
+	}
+
+	if s := values.Get("sort"); s != "" {
+		q.SortDesc = strings.HasPrefix(s, "-")
+		q.SortBy = strings.TrimPrefix(s, "-")
+		if !sortKeys[q.SortBy] {
+			return q, fmt.Errorf("invalid sort field %q", q.SortBy)
+		}
+	}
+
+	var err error
+	if q.Offset, err = intParam(values, "offset"); err != nil {
+		return q, err
+	}
+	if q.Limit, err = intParam(values, "limit"); err != nil {
+		return q, err
+	}
+
+	return q, nil
+}
+
+func listParam(values url.Values, key string) []string {
+	var out []string
+	for _, v := range values[key] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+func intParam(values url.Values, key string) (int, error) {
+	v := values.Get(key)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return n, nil
+}
+
+// Match reports whether a port satisfies every filter in the query
+func (q PortQuery) Match(ps PortSnapshot) bool {
+	if len(q.Interfaces) > 0 && !containsFold(q.Interfaces, ps.Interface) {
+		return false
+	}
+	if q.MaxPort > 0 && (ps.Port < q.MinPort || ps.Port > q.MaxPort) {
+		return false
+	}
+	if len(q.Categories) > 0 {
+		if ps.Insight == nil || !containsFold(q.Categories, string(ps.Insight.Category)) {
+			return false
+		}
+	}
+	if len(q.Risks) > 0 {
+		found := false
+		for _, r := range ps.Risks {
+			if containsFold(q.Risks, r) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(q.Usernames) > 0 {
+		if ps.Process == nil || !containsFold(q.Usernames, ps.Process.Username) {
+			return false
+		}
+	}
+	if len(q.Projects) > 0 {
+		if ps.Project == nil || !containsFold(q.Projects, ps.Project.Name) {
+			return false
+		}
+	}
+	if q.Forgotten != nil {
+		forgotten := ps.Insight != nil && ps.Insight.IsForgotten
+		if forgotten != *q.Forgotten {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply filters, sorts and pages a snapshot. It returns the selected page and
+// the number of ports that matched before paging.
+func (q PortQuery) Apply(in []PortSnapshot) ([]PortSnapshot, int) {
+	out := make([]PortSnapshot, 0, len(in))
+	for _, ps := range in {
+		if q.Match(ps) {
+			out = append(out, ps)
+		}
+	}
+
+	less := portLess(q.SortBy)
+	sort.SliceStable(out, func(i, j int) bool {
+		if q.SortDesc {
+			return less(out[j], out[i])
+		}
+		return less(out[i], out[j])
+	})
+
+	total := len(out)
+	if q.Offset >= total {
+		return []PortSnapshot{}, total
+	}
+	out = out[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(out) {
+		out = out[:q.Limit]
+	}
+	return out, total
+}
+
+// Project reduces each port to the requested JSON fields. With no field
+// selection the snapshot is returned unchanged.
+func (q PortQuery) Project(in []PortSnapshot) (interface{}, error) {
+	if len(q.Fields) == 0 {
+		return in, nil
+	}
+
+	out := make([]map[string]json.RawMessage, 0, len(in))
+	for _, ps := range in {
+		raw, err := json.Marshal(ps)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &all); err != nil {
+			return nil, err
+		}
+		selected := make(map[string]json.RawMessage, len(q.Fields))
+		for _, f := range q.Fields {
+			if v, ok := all[f]; ok {
+				selected[f] = v
+			}
+		}
+		out = append(out, selected)
+	}
+	return out, nil
+}
+
+// portLess returns the ordering for a sort key. Ties always fall back to the
+// port number so that results are stable between polls.
+func portLess(key string) func(a, b PortSnapshot) bool {
+	byPort := func(a, b PortSnapshot) bool { return a.Port < b.Port }
+
+	var primary func(a, b PortSnapshot) int
+	switch key {
+	case "pid":
+		primary = func(a, b PortSnapshot) int { return compareInt(int64(a.PID), int64(b.PID)) }
+	case "process":
+		primary = func(a, b PortSnapshot) int { return strings.Compare(processName(a), processName(b)) }
+	case "project":
+		primary = func(a, b PortSnapshot) int { return strings.Compare(projectName(a), projectName(b)) }
+	case "interface":
+		primary = func(a, b PortSnapshot) int { return strings.Compare(a.Interface, b.Interface) }
+	case "category":
+		primary = func(a, b PortSnapshot) int { return strings.Compare(categoryName(a), categoryName(b)) }
+	case "age":
+		// Oldest first, matching the ascending sense of the other keys
+		primary = func(a, b PortSnapshot) int { return compareInt(a.FirstSeen.UnixNano(), b.FirstSeen.UnixNano()) }
+	case "memory":
+		primary = func(a, b PortSnapshot) int {
+			ma, mb := processMemory(a), processMemory(b)
+			switch {
+			case ma < mb:
+				return -1
+			case ma > mb:
+				return 1
+			}
+			return 0
+		}
+	default:
+		return byPort
+	}
+
+	return func(a, b PortSnapshot) bool {
+		if c := primary(a, b); c != 0 {
+			return c < 0
+		}
+		return byPort(a, b)
+	}
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func processName(ps PortSnapshot) string {
+	if ps.Process == nil {
+		return ""
+	}
+	return strings.ToLower(ps.Process.Name)
+}
+
+func processMemory(ps PortSnapshot) float64 {
+	if ps.Process == nil {
+		return 0
+	}
+	return ps.Process.MemoryMB
+}
+
+func projectName(ps PortSnapshot) string {
+	if ps.Project == nil {
+		return ""
+	}
+	return strings.ToLower(ps.Project.Name)
+}
+
+func categoryName(ps PortSnapshot) string {
+	if ps.Insight == nil {
+		return ""
+	}
+	return string(ps.Insight.Category)
+}
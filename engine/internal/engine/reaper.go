@@ -0,0 +1,427 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"runstate/engine/internal/proc"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReapRule selects forgotten listeners that the reaper may stop. Zero fields
+// match anything; the listener must always be forgotten, belong to a project
+// and be owned by one of Users.
+type ReapRule struct {
+	Name          string
+	Category      ServiceCategory
+	Projects      []string // project names or root paths (a path also matches projects below it)
+	Users         []string // owners the rule may stop; empty matches nobody
+	MinAge        time.Duration
+	IdleFor       time.Duration
+	MinConfidence float64
+	Force         bool
+}
+
+// ReaperPolicy controls automatic termination of forgotten processes. The
+// reaper does nothing unless enabled from the config file.
+type ReaperPolicy struct {
+	Enabled  bool
+	DryRun   bool
+	Interval time.Duration
+	Grace    time.Duration // delay between the warning event and the action
+	Rules    []ReapRule
+	Exclude  []*regexp.Regexp
+}
+
+// Reaper is the active reaper policy
+var Reaper = ReaperPolicy{Interval: time.Minute, Grace: 5 * time.Minute}
+
+// maxReapHistory bounds the list of recent reaper actions
+const maxReapHistory = 50
+
+// ReapCandidate is a process the reaper has warned about
+type ReapCandidate struct {
+	PID      int32     `json:"pid"`
+	Process  string    `json:"process"`
+	Ports    []int     `json:"ports"`
+	Project  string    `json:"project"`
+	Rule     string    `json:"rule"`
+	Reasons  []string  `json:"reasons"`
+	WarnedAt time.Time `json:"warned_at"`
+	ActAt    time.Time `json:"act_at"`
+}
+
+// ReapAction records what the reaper did with a candidate once its grace
+// period ran out
+type ReapAction struct {
+	ReapCandidate
+	Time       time.Time       `json:"time"`
+	Outcome    string          `json:"outcome"` // terminated, failed, protected, dry_run
+	Simulation *KillSimulation `json:"simulation,omitempty"`
+	Result     *KillResult     `json:"result,omitempty"`
+}
+
+// ReapExemption is a process the reaper must leave alone, until Until for a
+// snooze or for its whole lifetime for a whitelist entry
+type ReapExemption struct {
+	PID     int32      `json:"pid"`
+	Process string     `json:"process"`
+	Until   *time.Time `json:"until,omitempty"`
+}
+
+// ReaperStatus is the reaper's policy state and recent activity
+type ReaperStatus struct {
+	Enabled     bool            `json:"enabled"`
+	DryRun      bool            `json:"dry_run"`
+	Pending     []ReapCandidate `json:"pending"`
+	Snoozed     []ReapExemption `json:"snoozed"`
+	Whitelisted []ReapExemption `json:"whitelisted"`
+	Recent      []ReapAction    `json:"recent"`
+}
+
+// reapKey identifies a process across PID reuse
+type reapKey struct {
+	pid     int32
+	created int64
+}
+
+func reapKeyFor(p proc.ProcInfo) reapKey {
+	return reapKey{pid: p.PID, created: p.CreateTime.UnixMilli()}
+}
+
+var (
+	reaperMu      sync.Mutex
+	reapPending   = make(map[reapKey]*ReapCandidate)
+	reapSnoozed   = make(map[reapKey]ReapExemption)
+	reapWhitelist = make(map[reapKey]ReapExemption)
+	reapDone      = make(map[reapKey]bool)
+	reapRecent    []ReapAction
+)
+
+// RunReaper evaluates the reaper policy on every interval until stop is
+// closed
+func RunReaper(stop <-chan struct{}) {
+	for {
+		configMu.RLock()
+		interval := Reaper.Interval
+		configMu.RUnlock()
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+
+		configMu.RLock()
+		policy := Reaper
+		configMu.RUnlock()
+		if !policy.Enabled {
+			continue
+		}
+
+		processes, err := proc.Snapshot()
+		if err != nil {
+			log.Printf("[reaper] process snapshot failed: %v", err)
+			continue
+		}
+		ports, err := SnapshotPorts()
+		if err != nil {
+			log.Printf("[reaper] port snapshot failed: %v", err)
+			continue
+		}
+		reap(policy, processes, ports, time.Now())
+	}
+}
+
+type reapTarget struct {
+	info  proc.ProcInfo
+	ports []PortSnapshot
+	rule  ReapRule
+}
+
+func reap(policy ReaperPolicy, processes map[int32]proc.ProcInfo, ports []PortSnapshot, now time.Time) {
+	// A process qualifies only if every port it listens on matches a rule
+	targets := make(map[reapKey]*reapTarget)
+	blocked := make(map[reapKey]bool)
+	for _, ps := range ports {
+		info, ok := processes[ps.PID]
+		if ps.PID <= 0 || !ok {
+			continue
+		}
+		key := reapKeyFor(info)
+		rule, ok := matchReapRule(policy, ps, now)
+		if !ok || reapExcluded(policy, info) {
+			blocked[key] = true
+			continue
+		}
+		t, ok := targets[key]
+		if !ok {
+			t = &reapTarget{info: info, rule: rule}
+			targets[key] = t
+		}
+		t.ports = append(t.ports, ps)
+	}
+	for key := range blocked {
+		delete(targets, key)
+	}
+
+	var warnings []PortEvent
+	var due []*reapTarget
+
+	reaperMu.Lock()
+	for key, c := range reapPending {
+		if _, ok := targets[key]; !ok {
+			log.Printf("[reaper] pid %d no longer matches rule %s, cancelled", c.PID, c.Rule)
+			delete(reapPending, key)
+		}
+	}
+	for key, ex := range reapSnoozed {
+		if now.After(*ex.Until) {
+			delete(reapSnoozed, key)
+		}
+	}
+	for key := range reapDone {
+		if p, ok := processes[key.pid]; !ok || reapKeyFor(p) != key {
+			delete(reapDone, key)
+		}
+	}
+	for key := range reapWhitelist {
+		if p, ok := processes[key.pid]; !ok || reapKeyFor(p) != key {
+			delete(reapWhitelist, key)
+		}
+	}
+
+	for key, t := range targets {
+		if reapDone[key] {
+			continue
+		}
+		if _, ok := reapWhitelist[key]; ok {
+			continue
+		}
+		if _, ok := reapSnoozed[key]; ok {
+			continue
+		}
+
+		c, ok := reapPending[key]
+		if !ok {
+			c = newReapCandidate(t, now, policy.Grace)
+			reapPending[key] = c
+
+			ev := portEvent(EventReapWarning, t.ports[0], now)
+			ev.Rule, ev.ActAt = c.Rule, c.ActAt
+			warnings = append(warnings, ev)
+			log.Printf("[reaper] pid %d (%s) matches rule %s, acting at %s", c.PID, c.Process, c.Rule, c.ActAt.Format(time.RFC3339))
+			continue
+		}
+		if !now.Before(c.ActAt) {
+			due = append(due, t)
+		}
+	}
+	reaperMu.Unlock()
+
+	for _, ev := range warnings {
+		publish(ev)
+	}
+	for _, t := range due {
+		reapProcess(policy, t, processes, ports, now)
+	}
+}
+
+func newReapCandidate(t *reapTarget, now time.Time, grace time.Duration) *ReapCandidate {
+	c := &ReapCandidate{
+		PID:      t.info.PID,
+		Process:  t.info.Name,
+		Rule:     t.rule.Name,
+		WarnedAt: now,
+		ActAt:    now.Add(grace),
+	}
+	for _, ps := range t.ports {
+		c.Ports = append(c.Ports, ps.Port)
+	}
+	sort.Ints(c.Ports)
+	first := t.ports[0]
+	if first.Project != nil {
+		c.Project = first.Project.Name
+	}
+	if first.Insight != nil {
+		c.Reasons = first.Insight.ForgottenReasons
+	}
+	return c
+}
+
+// reapProcess stops a candidate whose grace period is over, through the same
+// simulation and protection checks as a manual kill
+func reapProcess(policy ReaperPolicy, t *reapTarget, processes map[int32]proc.ProcInfo, ports []PortSnapshot, now time.Time) {
+	key := reapKeyFor(t.info)
+
+	reaperMu.Lock()
+	c, ok := reapPending[key]
+	if !ok {
+		// Snoozed or whitelisted since this pass started
+		reaperMu.Unlock()
+		return
+	}
+	delete(reapPending, key)
+	reapDone[key] = true
+	action := ReapAction{ReapCandidate: *c, Time: now}
+	reaperMu.Unlock()
+
+	sim := SimulateKill(t.info.PID, processes, ports)
+	RecordSimulation()
+	action.Simulation = &sim
+
+	switch {
+	case sim.IsProtected:
+		action.Outcome = "protected"
+		log.Printf("[reaper] pid %d is protected (%s), not stopping", c.PID, sim.ProtectedReason)
+	case policy.DryRun:
+		action.Outcome = "dry_run"
+		log.Printf("[reaper] dry run: would stop pid %d (%s) under rule %s", c.PID, c.Process, c.Rule)
+	default:
+		res := TerminateProcess(t.info.PID, t.rule.Force)
+		action.Result = &res
+		action.Outcome = "terminated"
+		if !res.Success {
+			action.Outcome = "failed"
+		}
+		log.Printf("[reaper] pid %d (%s) under rule %s: %s", c.PID, c.Process, c.Rule, res.Message)
+	}
+
+	reaperMu.Lock()
+	reapRecent = append(reapRecent, action)
+	if len(reapRecent) > maxReapHistory {
+		reapRecent = reapRecent[len(reapRecent)-maxReapHistory:]
+	}
+	reaperMu.Unlock()
+}
+
+// matchReapRule returns the first rule matching a forgotten listener
+func matchReapRule(policy ReaperPolicy, ps PortSnapshot, now time.Time) (ReapRule, bool) {
+	if ps.Insight == nil || !ps.Insight.IsForgotten || ps.Project == nil {
+		return ReapRule{}, false
+	}
+	for _, r := range policy.Rules {
+		if ps.Process == nil || !slices.Contains(r.Users, ps.Process.Username) {
+			continue
+		}
+		if r.Category != "" && ps.Insight.Category != r.Category {
+			continue
+		}
+		if len(r.Projects) > 0 && !projectListed(r.Projects, ps.Project) {
+			continue
+		}
+		if now.Sub(ps.FirstSeen) < r.MinAge {
+			continue
+		}
+		if r.IdleFor > 0 && (ps.Traffic == nil || now.Sub(ps.Traffic.LastActive) < r.IdleFor) {
+			continue
+		}
+		if ps.Insight.ForgottenConfidence < r.MinConfidence {
+			continue
+		}
+		return r, true
+	}
+	return ReapRule{}, false
+}
+
+func projectListed(projects []string, project *ProjectInfo) bool {
+	for _, p := range projects {
+		if p == project.Name {
+			return true
+		}
+		if filepath.IsAbs(p) {
+			rel, err := filepath.Rel(filepath.Clean(p), project.Path)
+			if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func reapExcluded(policy ReaperPolicy, p proc.ProcInfo) bool {
+	for _, re := range policy.Exclude {
+		if re.MatchString(p.Cmdline) || re.MatchString(p.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// exemptionTarget finds the listening process a snooze or whitelist request
+// refers to
+func exemptionTarget(pid int32) (reapKey, ReapExemption, error) {
+	ps, ok := lastKnownPort(pid)
+	if !ok || ps.Process == nil {
+		return reapKey{}, ReapExemption{}, fmt.Errorf("pid %d is not listening on any port", pid)
+	}
+	key := reapKey{pid: pid, created: ps.Process.CreateTime.UnixMilli()}
+	return key, ReapExemption{PID: pid, Process: ps.Process.Name}, nil
+}
+
+// SnoozeReap keeps the reaper away from a process for d
+func SnoozeReap(pid int32, d time.Duration) (ReapExemption, error) {
+	key, ex, err := exemptionTarget(pid)
+	if err != nil {
+		return ex, err
+	}
+	until := time.Now().Add(d)
+	ex.Until = &until
+
+	reaperMu.Lock()
+	defer reaperMu.Unlock()
+	delete(reapPending, key)
+	reapSnoozed[key] = ex
+	return ex, nil
+}
+
+// WhitelistReap keeps the reaper away from a process for as long as it runs
+func WhitelistReap(pid int32) (ReapExemption, error) {
+	key, ex, err := exemptionTarget(pid)
+	if err != nil {
+		return ex, err
+	}
+
+	reaperMu.Lock()
+	defer reaperMu.Unlock()
+	delete(reapPending, key)
+	delete(reapSnoozed, key)
+	reapWhitelist[key] = ex
+	return ex, nil
+}
+
+// GetReaperStatus returns the pending warnings, exemptions and recent actions
+func GetReaperStatus() ReaperStatus {
+	configMu.RLock()
+	st := ReaperStatus{Enabled: Reaper.Enabled, DryRun: Reaper.DryRun}
+	configMu.RUnlock()
+
+	reaperMu.Lock()
+	defer reaperMu.Unlock()
+
+	st.Pending = []ReapCandidate{}
+	for _, c := range reapPending {
+		st.Pending = append(st.Pending, *c)
+	}
+	sort.Slice(st.Pending, func(i, j int) bool { return st.Pending[i].ActAt.Before(st.Pending[j].ActAt) })
+
+	st.Snoozed = []ReapExemption{}
+	for _, ex := range reapSnoozed {
+		st.Snoozed = append(st.Snoozed, ex)
+	}
+	sort.Slice(st.Snoozed, func(i, j int) bool { return st.Snoozed[i].PID < st.Snoozed[j].PID })
+
+	st.Whitelisted = []ReapExemption{}
+	for _, ex := range reapWhitelist {
+		st.Whitelisted = append(st.Whitelisted, ex)
+	}
+	sort.Slice(st.Whitelisted, func(i, j int) bool { return st.Whitelisted[i].PID < st.Whitelisted[j].PID })
+
+	st.Recent = append([]ReapAction{}, reapRecent...)
+	return st
+}
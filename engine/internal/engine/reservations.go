@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"log"
+	"runstate/engine/internal/config"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PortReservation records which project declared a port in its .portwatch.yml
+type PortReservation struct {
+	Project string `json:"project"`
+	Service string `json:"service"`
+	Root    string `json:"root"`
+}
+
+// reservationTTL bounds how long a directory lookup is cached, so edits to
+// .portwatch.yml are picked up without a restart
+const reservationTTL = 30 * time.Second
+
+type reservationCacheEntry struct {
+	file    *config.ProjectFile
+	checked time.Time
+}
+
+var (
+	reservationMu    sync.Mutex
+	reservationCache = make(map[string]reservationCacheEntry)
+)
+
+// findReservations returns the project file governing cwd, if any
+func findReservations(cwd string, now time.Time) *config.ProjectFile {
+	reservationMu.Lock()
+	defer reservationMu.Unlock()
+
+	if e, ok := reservationCache[cwd]; ok && now.Sub(e.checked) < reservationTTL {
+		return e.file
+	}
+
+	pf, err := config.FindProjectFile(cwd)
+	if err != nil {
+		log.Printf("[reservations] %v", err)
+	}
+	reservationCache[cwd] = reservationCacheEntry{file: pf, checked: now}
+
+	// Drop stale lookups for processes that have gone away
+	for dir, e := range reservationCache {
+		if now.Sub(e.checked) >= reservationTTL {
+			delete(reservationCache, dir)
+		}
+	}
+	return pf
+}
+
+// applyReservations checks every listener against the ports its own project
+// and other running projects have declared. It raises PORT_CONFLICT when a
+// port reserved by one project is held by another, and UNEXPECTED_PORT when a
+// project with a .portwatch.yml listens on a port it did not declare.
+func applyReservations(out []PortSnapshot, now time.Time) {
+	owners := make([]*config.ProjectFile, len(out))
+	reservedBy := make(map[int][]*config.ProjectFile)
+	seen := make(map[string]bool)
+
+	for i, ps := range out {
+		if ps.Process == nil || ps.Process.Cwd == "" {
+			continue
+		}
+		pf := findReservations(ps.Process.Cwd, now)
+		if pf == nil {
+			continue
+		}
+		owners[i] = pf
+		if seen[pf.Root] {
+			continue
+		}
+		seen[pf.Root] = true
+		for port := range pf.Ports {
+			reservedBy[port] = append(reservedBy[port], pf)
+		}
+	}
+	for _, list := range reservedBy {
+		sort.Slice(list, func(i, j int) bool { return list[i].Root < list[j].Root })
+	}
+
+	for i := range out {
+		ps := &out[i]
+		owner := owners[i]
+
+		if owner != nil {
+			if service, ok := owner.Ports[ps.Port]; ok {
+				ps.Reservation = &PortReservation{Project: owner.Name, Service: service, Root: owner.Root}
+				continue
+			}
+			ps.Risks = append(ps.Risks, "UNEXPECTED_PORT")
+		}
+
+		// Only blame listeners whose own project we could look up
+		if ps.Process == nil || ps.Process.Cwd == "" {
+			continue
+		}
+		if holders := reservedBy[ps.Port]; len(holders) > 0 {
+			h := holders[0]
+			ps.Reservation = &PortReservation{Project: h.Name, Service: h.Ports[ps.Port], Root: h.Root}
+			ps.Risks = append(ps.Risks, "PORT_CONFLICT")
+		}
+	}
+}
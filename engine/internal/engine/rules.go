@@ -0,0 +1,98 @@
+package engine
+
+// genericRuntime is the weight of bare interpreter rules, low enough that any
+// specific tool running on the interpreter wins
+const genericRuntime = 0.4
+
+// ServiceRules are the built-in structured classification rules
+var ServiceRules = []ServiceRule{
+	// Node.js ecosystem
+	{Explanation: "Vite Dev Server", Icon: "node", Entrypoints: []string{"vite"}, Ports: []int{5173, 4173}, EnvMarkers: []string{"VITE_*"}},
+	{Explanation: "Webpack Dev Server", Icon: "node", Entrypoints: []string{"webpack", "webpack-dev-server", "webpack-cli"}, Ports: []int{8080}},
+	{Explanation: "Next.js Dev Server", Icon: "node", Executables: []string{"next-server", "next-router-worker"}, Entrypoints: []string{"next"}, Ports: []int{3000}, EnvMarkers: []string{"__NEXT_*", "NEXT_RUNTIME"}},
+	{Explanation: "Nuxt.js Dev Server", Icon: "node", Entrypoints: []string{"nuxt", "nuxi"}, Ports: []int{3000}, EnvMarkers: []string{"NUXT_*"}},
+	{Explanation: "CRA Dev Server", Icon: "node", Entrypoints: []string{"react-scripts"}, Ports: []int{3000}},
+	{Explanation: "Vue CLI Dev Server", Icon: "node", Entrypoints: []string{"vue-cli-service"}, Ports: []int{8080}},
+	{Explanation: "Angular Dev Server", Icon: "node", Entrypoints: []string{"ng"}, Subcommands: []string{"serve", "s"}, Ports: []int{4200}},
+	{Explanation: "esbuild bundler", Icon: "node", Executables: []string{"esbuild"}, Entrypoints: []string{"esbuild"}},
+	{Explanation: "Parcel Dev Server", Icon: "node", Entrypoints: []string{"parcel"}, Ports: []int{1234}},
+	{Explanation: "Rollup watcher", Icon: "node", Entrypoints: []string{"rollup"}},
+	{Explanation: "Nodemon monitor", Icon: "node", Entrypoints: []string{"nodemon"}, Parents: []string{"nodemon"}},
+	{Explanation: "TypeScript runtime", Icon: "node", Entrypoints: []string{"ts-node", "ts-node-dev"}},
+	{Explanation: "TSX runtime", Icon: "node", Entrypoints: []string{"tsx"}},
+	{Explanation: "npm script", Icon: "node", Executables: []string{"npm"}, Entrypoints: []string{"npm-cli"}, Subcommands: []string{"run", "run-script", "start", "exec"}},
+	{Explanation: "pnpm script", Icon: "node", Executables: []string{"pnpm"}, Entrypoints: []string{"pnpm"}},
+	{Explanation: "yarn script", Icon: "node", Executables: []string{"yarn"}, Entrypoints: []string{"yarn"}},
+
+	// Python ecosystem
+	{Explanation: "Flask Dev Server", Icon: "python", Entrypoints: []string{"flask"}, Subcommands: []string{"run"}, Ports: []int{5000}, EnvMarkers: []string{"FLASK_APP", "FLASK_DEBUG", "FLASK_RUN_*"}},
+	{Explanation: "Django Dev Server", Icon: "python", Entrypoints: []string{"manage", "django-admin"}, Subcommands: []string{"runserver"}, Ports: []int{8000}, EnvMarkers: []string{"DJANGO_SETTINGS_MODULE"}},
+	{Explanation: "Uvicorn ASGI Server", Icon: "python", Executables: []string{"uvicorn"}, Entrypoints: []string{"uvicorn"}, Ports: []int{8000}},
+	{Explanation: "Gunicorn WSGI Server", Icon: "python", Executables: []string{"gunicorn"}, Entrypoints: []string{"gunicorn"}, Ports: []int{8000}},
+	{Explanation: "FastAPI Server", Icon: "python", Entrypoints: []string{"fastapi"}, Subcommands: []string{"dev", "run"}, Ports: []int{8000}},
+	{Explanation: "Streamlit app", Icon: "python", Entrypoints: []string{"streamlit"}, Subcommands: []string{"run"}, Ports: []int{8501}},
+	{Explanation: "Jupyter Server", Icon: "python", Executables: []string{"jupyter-lab", "jupyter-notebook", "jupyter-server"}, Entrypoints: []string{"jupyter", "jupyter-lab", "jupyter-notebook"}, Ports: []int{8888}, EnvMarkers: []string{"JPY_*"}},
+
+	// Go ecosystem
+	{Explanation: "Go run command", Icon: "go", Executables: []string{"go"}, Subcommands: []string{"run"}, Parents: []string{"go"}},
+	{Explanation: "Air live reload (Go)", Icon: "go", Executables: []string{"air"}, Parents: []string{"air"}},
+	{Explanation: "Gin framework", Icon: "go", EnvMarkers: []string{"GIN_MODE"}},
+
+	// Rust ecosystem
+	{Explanation: "Cargo run/watch", Icon: "rust", Executables: []string{"cargo"}, Subcommands: []string{"run", "watch"}, Parents: []string{"cargo"}},
+	{Explanation: "Trunk dev server", Icon: "rust", Executables: []string{"trunk"}, Subcommands: []string{"serve"}, Ports: []int{8080}},
+
+	// Ruby ecosystem
+	{Explanation: "Rails dev server", Icon: "ruby", Entrypoints: []string{"rails"}, Subcommands: []string{"s", "server"}, Ports: []int{3000}, EnvMarkers: []string{"RAILS_ENV"}},
+	{Explanation: "Puma web server", Icon: "ruby", Executables: []string{"puma"}, Entrypoints: []string{"puma"}, Ports: []int{9292}},
+
+	// Java/JVM ecosystem
+	{Explanation: "Spring Boot app", Icon: "java", Entrypoints: []string{"spring-boot:run", "bootrun"}, Ports: []int{8080}, EnvMarkers: []string{"SPRING_*"}},
+
+	// Database/Services
+	{Explanation: "PostgreSQL Database", Icon: "database", Executables: []string{"postgres", "postmaster"}, Ports: []int{5432}},
+	{Explanation: "MySQL Database", Icon: "database", Executables: []string{"mysqld", "mariadbd"}, Ports: []int{3306}},
+	{Explanation: "Redis Server", Icon: "database", Executables: []string{"redis-server", "valkey-server"}, Ports: []int{6379}},
+	{Explanation: "MongoDB Server", Icon: "database", Executables: []string{"mongod"}, Ports: []int{27017}},
+	{Explanation: "Memcached Server", Icon: "database", Executables: []string{"memcached"}, Ports: []int{11211}},
+	{Explanation: "SurrealDB Server", Icon: "database", Executables: []string{"surreal"}, Subcommands: []string{"start"}, Ports: []int{8000}},
+	{Explanation: "ClickHouse Database", Icon: "database", Executables: []string{"clickhouse-server", "clickhouse"}, Ports: []int{8123, 9000}},
+
+	// Containerization & Orchestration
+	{Explanation: "Docker Proxy", Icon: "docker", Executables: []string{"docker-proxy"}},
+	{Explanation: "Docker Daemon", Icon: "docker", Executables: []string{"dockerd"}},
+	{Explanation: "Container Runtime", Icon: "docker", Executables: []string{"containerd"}},
+	{Explanation: "Container Runtime (Shim)", Icon: "docker", Executables: []string{"containerd-shim", "containerd-shim-runc-v2"}},
+	{Explanation: "Podman Container Monitor", Icon: "docker", Executables: []string{"conmon"}},
+	{Explanation: "Rootless Container Port Forwarder", Icon: "docker", Executables: []string{"rootlessport", "rootlessport-child", "rootlesskit", "slirp4netns", "pasta", "pasta.avx2"}},
+	{Explanation: "Kubernetes Kubelet", Icon: "k8s", Executables: []string{"kubelet"}},
+	{Explanation: "Kubernetes Proxy", Icon: "k8s", Executables: []string{"kube-proxy"}},
+	{Explanation: "Minikube Cluster", Icon: "k8s", Executables: []string{"minikube"}},
+	{Explanation: "Kubernetes CLI", Icon: "k8s", Executables: []string{"kubectl"}},
+	{Explanation: "Helm (K8s)", Icon: "k8s", Executables: []string{"helm"}},
+
+	// Tunnels & Reverse Proxies
+	{Explanation: "SSH Tunnel", Icon: "network", Executables: []string{"ssh", "autossh"}},
+	{Explanation: "socat Relay", Icon: "network", Executables: []string{"socat"}},
+	{Explanation: "Nginx Reverse Proxy", Icon: "network", Executables: []string{"nginx"}, Ports: []int{80, 443}},
+	{Explanation: "Caddy Server", Icon: "network", Executables: []string{"caddy"}, Ports: []int{80, 443}},
+	{Explanation: "Traefik Proxy", Icon: "network", Executables: []string{"traefik"}, Ports: []int{80, 443}},
+
+	// Message Brokers
+	{Explanation: "RabbitMQ Server", Icon: "message-broker", Entrypoints: []string{"rabbitmq-server", "rabbit"}, Ports: []int{5672, 15672}, EnvMarkers: []string{"RABBITMQ_*"}},
+	{Explanation: "Apache Kafka", Icon: "message-broker", Entrypoints: []string{"kafka.kafka", "kafka-server-start"}, Ports: []int{9092}},
+	{Explanation: "NATS Server", Icon: "message-broker", Executables: []string{"nats-server"}, Ports: []int{4222}},
+
+	// Tauri/Electron
+	{Explanation: "Tauri dev server", Icon: "tauri", Executables: []string{"cargo-tauri"}, Entrypoints: []string{"tauri"}, Parents: []string{"cargo-tauri"}},
+	{Explanation: "Electron app", Icon: "electron", Executables: []string{"electron"}},
+
+	// Generic runtimes (lower priority)
+	{Explanation: "Node.js process", Icon: "node", Executables: []string{"node", "nodejs"}, Weight: genericRuntime},
+	{Explanation: "Python process", Icon: "python", Executables: []string{"python"}, Weight: genericRuntime},
+	{Explanation: "Ruby process", Icon: "ruby", Executables: []string{"ruby"}, Weight: genericRuntime},
+	{Explanation: "Java process", Icon: "java", Executables: []string{"java"}, Weight: genericRuntime},
+	{Explanation: "PHP process", Icon: "php", Executables: []string{"php", "php-fpm"}, Weight: genericRuntime},
+	{Explanation: "Bun process", Icon: "node", Executables: []string{"bun"}, Weight: genericRuntime},
+	{Explanation: "Deno process", Icon: "node", Executables: []string{"deno"}, Weight: genericRuntime},
+}
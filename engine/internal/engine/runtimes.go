@@ -0,0 +1,246 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runstate/engine/internal/docker"
+	"runstate/engine/internal/nerdctl"
+	"strings"
+	"time"
+)
+
+// ContainerRuntime is one reachable container runtime endpoint: a daemon
+// socket, or a CLI for runtimes without a REST API
+type ContainerRuntime interface {
+	// Name is the runtime reported in ContainerInfo: docker, podman or containerd
+	Name() string
+	// Endpoint identifies the socket or CLI, e.g. for logs
+	Endpoint() string
+	List(ctx context.Context) ([]RuntimeContainer, error)
+	Stop(ctx context.Context, id string, timeout time.Duration) error
+	Restart(ctx context.Context, id string, timeout time.Duration) error
+	// Remove deletes a stopped container, keeping its volumes
+	Remove(ctx context.Context, id string) error
+}
+
+// RuntimeContainer is a running container and the host TCP ports it publishes
+type RuntimeContainer struct {
+	Info  ContainerInfo
+	Ports map[int]int // host port -> container port
+
+	runtime ContainerRuntime
+}
+
+/* -------------------- docker-compatible API -------------------- */
+
+// apiRuntime speaks the Docker Engine API, which podman also serves on its
+// socket
+type apiRuntime struct {
+	name     string
+	rootless bool
+	client   *docker.Client
+}
+
+func (r *apiRuntime) Name() string     { return r.name }
+func (r *apiRuntime) Endpoint() string { return r.client.Socket }
+
+func (r *apiRuntime) List(ctx context.Context) ([]RuntimeContainer, error) {
+	list, err := r.client.ListContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]RuntimeContainer, 0, len(list))
+	for _, c := range list {
+		rc := RuntimeContainer{
+			Info: ContainerInfo{
+				Runtime:        r.name,
+				Rootless:       r.rootless,
+				ID:             c.ID,
+				Name:           c.Name(),
+				Image:          c.Image,
+				State:          c.State,
+				Status:         c.Status,
+				ComposeProject: c.Labels[docker.LabelComposeProject],
+				ComposeService: c.Labels[docker.LabelComposeService],
+				Labels:         c.Labels,
+			},
+			Ports: make(map[int]int),
+		}
+		for _, b := range c.Ports {
+			if b.Type == "tcp" && b.PublicPort != 0 {
+				rc.Ports[b.PublicPort] = b.PrivatePort
+			}
+		}
+		out = append(out, rc)
+	}
+	return out, nil
+}
+
+func (r *apiRuntime) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	return r.client.StopContainer(ctx, id, timeout)
+}
+
+func (r *apiRuntime) Restart(ctx context.Context, id string, timeout time.Duration) error {
+	return r.client.RestartContainer(ctx, id, timeout)
+}
+
+func (r *apiRuntime) Remove(ctx context.Context, id string) error {
+	return r.client.RemoveContainer(ctx, id, false)
+}
+
+/* -------------------- containerd via nerdctl -------------------- */
+
+type nerdctlRuntime struct {
+	rootless bool
+	client   *nerdctl.Client
+}
+
+func (r *nerdctlRuntime) Name() string     { return "containerd" }
+func (r *nerdctlRuntime) Endpoint() string { return r.client.Path }
+
+func (r *nerdctlRuntime) List(ctx context.Context) ([]RuntimeContainer, error) {
+	list, err := r.client.ListContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]RuntimeContainer, 0, len(list))
+	for _, c := range list {
+		labels := nerdctl.ParseLabels(c.Labels)
+		rc := RuntimeContainer{
+			Info: ContainerInfo{
+				Runtime:        "containerd",
+				Rootless:       r.rootless,
+				ID:             c.ID,
+				Name:           c.Names,
+				Image:          c.Image,
+				State:          "running", // nerdctl ps lists running containers only
+				Status:         c.Status,
+				ComposeProject: labels[docker.LabelComposeProject],
+				ComposeService: labels[docker.LabelComposeService],
+				Labels:         labels,
+			},
+			Ports: make(map[int]int),
+		}
+		if rc.Info.Name == "" {
+			rc.Info.Name = docker.ShortID(c.ID)
+		}
+		for _, m := range nerdctl.ParsePorts(c.Ports) {
+			if m.Protocol == "tcp" {
+				rc.Ports[m.HostPort] = m.ContainerPort
+			}
+		}
+		out = append(out, rc)
+	}
+	return out, nil
+}
+
+func (r *nerdctlRuntime) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	return r.client.StopContainer(ctx, id, timeout)
+}
+
+func (r *nerdctlRuntime) Restart(ctx context.Context, id string, timeout time.Duration) error {
+	return r.client.RestartContainer(ctx, id, timeout)
+}
+
+func (r *nerdctlRuntime) Remove(ctx context.Context, id string) error {
+	return r.client.RemoveContainer(ctx, id)
+}
+
+/* -------------------- discovery -------------------- */
+
+// Well-known runtime sockets. Rootless daemons keep theirs in the owning
+// user's runtime directory, which root can reach for every user.
+const (
+	podmanSocket     = "/run/podman/podman.sock"
+	containerdSocket = "/run/containerd/containerd.sock"
+)
+
+var (
+	rootlessDockerSockets = "/run/user/*/docker.sock"
+	rootlessPodmanSockets = "/run/user/*/podman/podman.sock"
+)
+
+// runtimeCache keeps one runtime per endpoint so HTTP clients and their idle
+// connections are reused between discoveries. Guarded by containerMu.
+var runtimeCache = make(map[string]ContainerRuntime)
+
+// discoverRuntimes returns the container runtimes reachable from this
+// process. Sockets reached through symlinks are listed once, so a docker.sock
+// provided by podman-docker is treated as podman.
+func discoverRuntimes() []ContainerRuntime {
+	var out []ContainerRuntime
+	seen := make(map[string]bool)
+
+	addSocket := func(name, socket string) {
+		real, err := filepath.EvalSymlinks(socket)
+		if err != nil || seen[real] {
+			return
+		}
+		if fi, err := os.Stat(real); err != nil || fi.Mode()&os.ModeSocket == 0 {
+			return
+		}
+		seen[real] = true
+		if strings.Contains(real, "podman") {
+			name = "podman"
+		}
+
+		key := name + ":" + real
+		rt, ok := runtimeCache[key]
+		if !ok {
+			rt = &apiRuntime{name: name, rootless: strings.HasPrefix(real, "/run/user/"), client: docker.NewClient(real)}
+			runtimeCache[key] = rt
+		}
+		out = append(out, rt)
+	}
+
+	if socket, err := docker.SocketFromEnv(); err == nil {
+		addSocket("docker", socket)
+	}
+	if path, ok := strings.CutPrefix(os.Getenv("CONTAINER_HOST"), "unix://"); ok {
+		addSocket("podman", path)
+	}
+	addSocket("podman", podmanSocket)
+	for _, pattern := range []string{rootlessDockerSockets, rootlessPodmanSockets} {
+		matches, _ := filepath.Glob(pattern)
+		for _, socket := range matches {
+			addSocket("docker", socket)
+		}
+	}
+
+	if rt := nerdctlRuntimeFor(); rt != nil {
+		out = append(out, rt)
+	}
+	return out
+}
+
+// nerdctlRuntimeFor returns the containerd runtime when nerdctl is installed
+// and a containerd it can reach is running: the system daemon for root, the
+// user's rootless containerd otherwise. nerdctl picks between them by the
+// effective user, so other users' rootless containerd stays out of reach.
+func nerdctlRuntimeFor() ContainerRuntime {
+	rootless := os.Geteuid() != 0
+	marker := containerdSocket
+	if rootless {
+		dir := os.Getenv("XDG_RUNTIME_DIR")
+		if dir == "" {
+			return nil
+		}
+		marker = filepath.Join(dir, "containerd-rootless")
+	}
+	if _, err := os.Stat(marker); err != nil {
+		return nil
+	}
+
+	if rt, ok := runtimeCache["containerd"]; ok {
+		return rt
+	}
+	client, err := nerdctl.LookPath()
+	if err != nil {
+		return nil
+	}
+	client.Namespace = os.Getenv("CONTAINERD_NAMESPACE")
+	rt := &nerdctlRuntime{rootless: rootless, client: client}
+	runtimeCache["containerd"] = rt
+	return rt
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runstate/engine/internal/docker"
+	"strings"
+	"testing"
+)
+
+func TestAPIRuntimeListMapsPorts(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/containers/json") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[{
+			"Id": "0123456789abcdef",
+			"Names": ["/shop-web-1"],
+			"Image": "shop/web",
+			"State": "running",
+			"Labels": {"com.docker.compose.project": "shop", "com.docker.compose.service": "web", "tier": "frontend"},
+			"Ports": [
+				{"IP": "0.0.0.0", "PrivatePort": 3000, "PublicPort": 8080, "Type": "tcp"},
+				{"IP": "0.0.0.0", "PrivatePort": 53, "PublicPort": 5353, "Type": "udp"},
+				{"PrivatePort": 9229, "Type": "tcp"}
+			]
+		}]`))
+	}))
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+
+	rt := &apiRuntime{name: "podman", rootless: true, client: docker.NewClient(socket)}
+	list, err := rt.List(context.Background())
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("got %d containers, want 1", len(list))
+	}
+
+	c := list[0]
+	info := c.Info
+	if info.Runtime != "podman" || !info.Rootless || info.Name != "shop-web-1" || info.Image != "shop/web" {
+		t.Errorf("info = %+v", info)
+	}
+	if info.ComposeProject != "shop" || info.ComposeService != "web" || info.Labels["tier"] != "frontend" {
+		t.Errorf("compose/labels = %q %q %v", info.ComposeProject, info.ComposeService, info.Labels)
+	}
+	// Only published TCP ports count
+	if len(c.Ports) != 1 || c.Ports[8080] != 3000 {
+		t.Errorf("ports = %v, want map[8080:3000]", c.Ports)
+	}
+}
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"fmt"
 	"runstate/engine/internal/proc"
 	"strings"
 )
@@ -33,10 +34,18 @@ type KillSimulation struct {
 	SystemService   string          `json:"system_service,omitempty"`
 	ProtectedReason string          `json:"protected_reason,omitempty"`
 	Warnings        []string        `json:"warnings"`
+
+	// Set when the target forwards or runs a container; the container
+	// actions should be offered instead of a kill
+	Container        *ContainerInfo `json:"container,omitempty"`
+	ContainerActions []string       `json:"container_actions,omitempty"`
 }
 
 // IsProtectedPort checks if a port is system-critical
 func IsProtectedPort(port int) (bool, string) {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
 	if reason, ok := ProtectedPorts[port]; ok {
 		return true, reason
 	}
@@ -45,6 +54,9 @@ func IsProtectedPort(port int) (bool, string) {
 
 // IsProtectedUser checks if a username is a system account
 func IsProtectedUser(username string) bool {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
 	username = strings.ToLower(username)
 	for _, u := range ProtectedUsers {
 		if username == u {
@@ -169,6 +181,16 @@ func SimulateKill(pid int32, processes map[int32]proc.ProcInfo, ports []PortSnap
 	// Get affected ports
 	sim.AffectedPorts = GetProcessPorts(pid, sim.ChildProcesses, ports)
 
+	// Local clients lose their connections; the target's own children go
+	// down with it and don't count
+	dying := map[int32]bool{pid: true}
+	for _, child := range sim.ChildProcesses {
+		dying[child.PID] = true
+	}
+	if w := clientWarning(sim.AffectedPorts, dying, processes, ports); w != "" {
+		sim.Warnings = append(sim.Warnings, w)
+	}
+
 	// Check if any affected ports are protected
 	for _, port := range sim.AffectedPorts {
 		if protected, reason := IsProtectedPort(port); protected {
@@ -178,5 +200,15 @@ func SimulateKill(pid int32, processes map[int32]proc.ProcInfo, ports []PortSnap
 		}
 	}
 
+	// Killing docker-proxy, a rootless forwarder or a shim breaks the
+	// container rather than stopping it
+	if c := containerForKill(pid, processes, ports, sim.AffectedPorts); c != nil {
+		sim.Container = c
+		sim.ContainerActions = ContainerActions
+		sim.Warnings = append(sim.Warnings, fmt.Sprintf(
+			"Belongs to container %s (%s); stop, restart or remove the container instead of killing the process", c.Name, c.Image))
+		sim.Warnings = append(sim.Warnings, containerWarnings(*c, ports)...)
+	}
+
 	return sim
 }
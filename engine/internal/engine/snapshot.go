@@ -5,7 +5,8 @@ import (
 	"net"
 	"runstate/engine/internal/ports"
 	"runstate/engine/internal/proc"
-	"strings"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 )
@@ -25,17 +26,30 @@ type PortSnapshot struct {
 	Traffic *TrafficInfo `json:"traffic,omitempty"`
 	Risks   []string     `json:"risks,omitempty"`
 	Project *ProjectInfo `json:"project,omitempty"`
-}
 
-type TrafficInfo struct {
-	TxQueue  int64 `json:"tx_queue"`
-	RxQueue  int64 `json:"rx_queue"`
-	IsActive bool  `json:"is_active"`
+	Reservation *PortReservation `json:"reservation,omitempty"`
+	Health      *HealthStatus    `json:"health,omitempty"`
+	Backlog     *BacklogInfo     `json:"backlog,omitempty"`
+	Container   *ContainerInfo   `json:"container,omitempty"`
+	KubeForward *KubeForward     `json:"kube_forward,omitempty"`
+	// ForwardsTo lists the backends a tunnel or proxy on this port leads to
+	ForwardsTo []ForwardTarget `json:"forwards_to,omitempty"`
 }
 
-type ProjectInfo struct {
-	Name string `json:"name"`
-	Path string `json:"path"`
+type TrafficInfo struct {
+	IsActive bool `json:"is_active"`
+	// LastActive is when the listener last saw traffic, FirstSeen if never
+	LastActive time.Time `json:"last_active"`
+
+	// Established connections accepted on this port, and what changed since
+	// the previous scan
+	Connections    int     `json:"connections"`
+	Accepts        int     `json:"accepts"`
+	Closes         int     `json:"closes"`
+	ConnRate       float64 `json:"conn_rate"` // accepts per second
+	BytesInPerSec  float64 `json:"bytes_in_per_sec"`
+	BytesOutPerSec float64 `json:"bytes_out_per_sec"`
+	ByteCounters   bool    `json:"byte_counters"` // false when sock_diag is unavailable
 }
 
 /* -------------------- interface classification -------------------- */
@@ -69,59 +83,104 @@ type portStateEntry struct {
 	FirstSeen time.Time
 	LastSeen  time.Time
 	Misses    int
-	LastTx    int64
-	LastRx    int64
+	// LastActive is the last scan that saw traffic on the listener
+	LastActive time.Time
+	Last       *PortSnapshot
+}
+
+func pidKey(pid int32) string {
+	return fmt.Sprintf("%d", pid)
 }
 
 var (
 	stateMu   sync.Mutex
 	portState = make(map[portKey]*portStateEntry)
+	// lastOwners is the socket owner map of the latest scan, reused to
+	// attribute client connections without another pass over /proc
+	lastOwners map[string]int32
 )
 
-/* -------------------- project identification -------------------- */
-func getProjectInfo(cwd string) *ProjectInfo {
-	if cwd == "" {
-		return nil
-	}
-	// Simple heuristic: last part of the path
-	parts := strings.Split(strings.TrimRight(cwd, "/"), "/")
-	if len(parts) == 0 {
-		return nil
-	}
-	name := parts[len(parts)-1]
-	// Avoid generic names
-	if name == "src" || name == "app" || name == "build" || name == "dist" {
-		if len(parts) > 1 {
-			name = parts[len(parts)-2] + "/" + name
+/* -------------------- scanner -------------------- */
+
+// ScanInterval is how often RunScanner rescans listeners, matching the UI's
+// poll. Traffic rates, backlog saturation and open/close events are deltas
+// between consecutive scans, so only the scanner scans and every consumer
+// reads its latest result.
+const ScanInterval = 2 * time.Second
+
+var (
+	scanMu      sync.Mutex
+	scanned     bool
+	latestPorts []PortSnapshot
+	latestErr   error
+)
+
+// RunScanner scans listeners every ScanInterval until stop is closed
+func RunScanner(stop <-chan struct{}) {
+	ticker := time.NewTicker(ScanInterval)
+	defer ticker.Stop()
+	for {
+		scanMu.Lock()
+		latestPorts, latestErr = scanPorts()
+		scanned = true
+		scanMu.Unlock()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
 		}
 	}
+}
 
-	return &ProjectInfo{
-		Name: name,
-		Path: cwd,
+// SnapshotPorts returns the listeners of the latest scan. It scans only when
+// no scan has run yet.
+func SnapshotPorts() ([]PortSnapshot, error) {
+	scanMu.Lock()
+	defer scanMu.Unlock()
+	if !scanned {
+		latestPorts, latestErr = scanPorts()
+		scanned = true
 	}
+	return slices.Clone(latestPorts), latestErr
 }
 
 /* -------------------- snapshot -------------------- */
 
-func SnapshotPorts() ([]PortSnapshot, error) {
-	procs, err := proc.Snapshot()
-	if err != nil {
-		return nil, err
-	}
+func scanPorts() ([]PortSnapshot, error) {
+	start := time.Now()
+	defer func() { recordScan(time.Since(start)) }()
 
 	tcpPorts, err := ports.ListTCPPorts()
 	if err != nil {
 		return nil, err
 	}
 
+	// One pass over /proc/*/fd finds every listener's owner; only those and
+	// their ancestors are read
+	owners := ports.SocketOwners()
+	stateMu.Lock()
+	lastOwners = owners
+	stateMu.Unlock()
+	var ownerPIDs []int32
+	for _, p := range tcpPorts {
+		if pid, ok := owners[p.Inode]; ok {
+			ownerPIDs = append(ownerPIDs, pid)
+		}
+	}
+	procs := proc.SnapshotPIDs(ownerPIDs)
+
 	now := time.Now()
+	trafficByPort := accountTraffic(tcpPorts, now)
+	overflows, drops := listenStatsDelta()
+	queues := listenQueues()
+	containers := publishedContainerPorts()
 
 	// Dedup by port number to handle multi-interface listeners (e.g. 0.0.0.0 and 127.0.0.1)
 	portMap := make(map[int]PortSnapshot)
 
 	for _, p := range tcpPorts {
-		pid, _ := ports.InodeToPID(p.Inode)
+		pid := owners[p.Inode]
 		info, hasProc := procs[pid]
 
 		// Skip noise but continue tracking state
@@ -133,24 +192,31 @@ func SnapshotPorts() ([]PortSnapshot, error) {
 		// State key using port+PID
 		sKey := portKey{
 			Port:  p.Port,
-			Inode: fmt.Sprintf("%d", pid),
+			Inode: pidKey(pid),
 		}
 
 		stateMu.Lock()
 		entry, exists := portState[sKey]
 		if !exists {
-			entry = &portStateEntry{FirstSeen: now}
+			entry = &portStateEntry{FirstSeen: now, LastActive: now}
 			portState[sKey] = entry
 		}
 
-		// Traffic awareness
-		isActive := (p.TxQueue > entry.LastTx) || (p.RxQueue > entry.LastRx)
-		entry.LastTx = p.TxQueue
-		entry.LastRx = p.RxQueue
+		// Traffic awareness: accepted connections and bytes moved since the
+		// previous scan. The queue columns of a listener are its accept
+		// queue, assessed separately below.
+		traffic := trafficByPort[p.Port]
+		isActive := traffic.hasTraffic()
+		if isActive {
+			entry.LastActive = now
+		}
 		entry.LastSeen = now
 		entry.Misses = 0
+		lastActive := entry.LastActive
 		stateMu.Unlock()
 
+		traffic.IsActive, traffic.LastActive = isActive, lastActive
+
 		ps := PortSnapshot{
 			Port:      p.Port,
 			LocalAddr: p.LocalAddr,
@@ -158,11 +224,12 @@ func SnapshotPorts() ([]PortSnapshot, error) {
 			PID:       pid,
 			FirstSeen: entry.FirstSeen,
 			LastSeen:  entry.LastSeen,
-			Traffic: &TrafficInfo{
-				TxQueue:  p.TxQueue,
-				RxQueue:  p.RxQueue,
-				IsActive: isActive,
-			},
+			Traffic:   &traffic,
+		}
+		q, haveLimit := queues[p.Inode]
+		ps.Backlog = assessBacklog(p, q, haveLimit, overflows, drops, now)
+		if ps.Backlog.Saturated {
+			ps.Risks = append(ps.Risks, "BACKLOG_SATURATED")
 		}
 
 		if hasProc {
@@ -176,7 +243,23 @@ func SnapshotPorts() ([]PortSnapshot, error) {
 					ps.Risks = append(ps.Risks, "ORPHANED_PROCESS")
 				}
 			}
-			ps.Insight = GenerateInsight(entry.FirstSeen, info.Cmdline, info.Name, 10*time.Minute)
+			configMu.RLock()
+			threshold := ForgottenThreshold
+			configMu.RUnlock()
+			ps.Insight = GenerateInsight(entry.FirstSeen, lastActive, classifyInputFor(info, p.Port, procs), threshold)
+			if kf, ok := ParsePortForward(info.Args); ok {
+				if _, forwarded := kf.MappingFor(p.Port); forwarded {
+					ps.KubeForward = kf
+				}
+			}
+			ps.ForwardsTo = forwardsFor(info, p.Port, procs)
+			for _, t := range ps.ForwardsTo {
+				evidence := "forwards to " + t.Target
+				if t.Gateway != "" {
+					evidence += " via " + t.Gateway
+				}
+				ps.Insight.Evidence = append(ps.Insight.Evidence, evidence)
+			}
 		} else {
 			// Try to identify service by port if no process found (e.g. Docker, system service)
 			if expl, icon, ok := GenerateInsightFromPort(ps.Port); ok && icon != "system" {
@@ -217,6 +300,18 @@ func SnapshotPorts() ([]PortSnapshot, error) {
 				}
 				ps.Risks = append(ps.Risks, "HIDDEN_PROCESS")
 			}
+
+			// Without a visible process, ask the listener what it speaks
+			if res := probeListener(ps); res != nil {
+				applyProbe(ps.Insight, res)
+				if res.Protocol != "unknown" {
+					ps.Process.Name = ps.Insight.Explanation
+				}
+			}
+		}
+
+		if c, ok := containers[ps.Port]; ok && ps.Insight != nil {
+			applyContainer(&ps, c)
 		}
 
 		// Security Risk Heuristic: Public Exposure
@@ -237,6 +332,21 @@ func SnapshotPorts() ([]PortSnapshot, error) {
 			}
 		}
 
+		if health := checkHealth(ps); health != nil {
+			ps.Health = health
+			if !health.Healthy {
+				ps.Risks = append(ps.Risks, "UNHEALTHY")
+			}
+		}
+
+		stateMu.Lock()
+		last := ps
+		entry.Last = &last
+		stateMu.Unlock()
+		if !exists {
+			publish(portEvent(EventPortOpen, ps, now))
+		}
+
 		// Dedup choice: prefer 'any' (0.0.0.0) or 'public' over 'loopback'
 		existing, found := portMap[ps.Port]
 		if !found {
@@ -265,18 +375,37 @@ func SnapshotPorts() ([]PortSnapshot, error) {
 	for _, ps := range portMap {
 		out = append(out, ps)
 	}
+	// Map iteration order is random; keep the output stable between polls
+	sort.Slice(out, func(i, j int) bool { return out[i].Port < out[j].Port })
+	applyReservations(out, now)
+	markLocalForwards(out)
+
+	open := make(map[int]bool, len(out))
+	for _, ps := range out {
+		open[ps.Port] = true
+	}
+	pruneProbes(open)
+	pruneHealth(open)
+	pruneBacklog(tcpPorts)
 
 	// Prune inactive ports from state tracking
+	var closed []PortSnapshot
 	stateMu.Lock()
 	for k, v := range portState {
 		if v.LastSeen != now {
 			v.Misses++
 			if v.Misses > 3 {
+				if v.Last != nil {
+					closed = append(closed, *v.Last)
+				}
 				delete(portState, k)
 			}
 		}
 	}
 	stateMu.Unlock()
+	for _, ps := range closed {
+		publish(portEvent(EventPortClose, ps, now))
+	}
 
 	return out, nil
 }
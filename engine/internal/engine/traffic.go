@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"log"
+	"runstate/engine/internal/ports"
+	"sync"
+	"time"
+)
+
+// connKey identifies an accepted connection between scans
+type connKey struct {
+	LocalAddr  string
+	RemoteAddr string
+	RemotePort int
+}
+
+type connSample struct {
+	bytes    ports.SocketBytes
+	hasBytes bool
+}
+
+type listenerTraffic struct {
+	scannedAt time.Time
+	conns     map[connKey]connSample
+}
+
+var (
+	trafficMu    sync.Mutex
+	trafficState = make(map[int]*listenerTraffic)
+
+	byteCountersOnce sync.Once
+)
+
+// accountTraffic attributes established connections to the listeners they
+// were accepted on and compares them with the previous scan. The returned
+// TrafficInfo carries the connection fields only; queue fields are filled in
+// by the caller.
+func accountTraffic(listeners []ports.TcpPort, now time.Time) map[int]TrafficInfo {
+	listening := make(map[int]bool, len(listeners))
+	for _, l := range listeners {
+		listening[l.Port] = true
+	}
+
+	conns, err := ports.ListTCPConnections()
+	if err != nil {
+		log.Printf("[traffic] listing connections failed: %v", err)
+	}
+	counters, err := ports.ByteCounters()
+	if err != nil {
+		byteCountersOnce.Do(func() {
+			log.Printf("[traffic] byte counters unavailable, reporting connections only: %v", err)
+		})
+	}
+
+	current := make(map[int]map[connKey]connSample)
+	for _, c := range conns {
+		// Only the server side of a connection has the listener's port as
+		// its local port
+		if !listening[c.LocalPort] {
+			continue
+		}
+		if current[c.LocalPort] == nil {
+			current[c.LocalPort] = make(map[connKey]connSample)
+		}
+		sample := connSample{}
+		if b, ok := counters[c.Inode]; ok && c.Inode != "0" {
+			sample = connSample{bytes: b, hasBytes: true}
+		}
+		current[c.LocalPort][connKey{c.LocalAddr, c.RemoteAddr, c.RemotePort}] = sample
+	}
+
+	trafficMu.Lock()
+	defer trafficMu.Unlock()
+
+	out := make(map[int]TrafficInfo, len(listening))
+	for port := range listening {
+		cur := current[port]
+		info := TrafficInfo{Connections: len(cur), ByteCounters: counters != nil}
+
+		prev, seen := trafficState[port]
+		if seen {
+			elapsed := now.Sub(prev.scannedAt).Seconds()
+
+			var sent, received uint64
+			for k, s := range cur {
+				p, existed := prev.conns[k]
+				if !existed {
+					info.Accepts++
+				}
+				if !s.hasBytes {
+					continue
+				}
+				// A connection accepted since the last scan moved all of
+				// its bytes within the interval
+				if existed && p.hasBytes && s.bytes.Sent >= p.bytes.Sent && s.bytes.Received >= p.bytes.Received {
+					sent += s.bytes.Sent - p.bytes.Sent
+					received += s.bytes.Received - p.bytes.Received
+				} else if !existed {
+					sent += s.bytes.Sent
+					received += s.bytes.Received
+				}
+			}
+			for k := range prev.conns {
+				if _, ok := cur[k]; !ok {
+					info.Closes++
+				}
+			}
+
+			if elapsed > 0 {
+				info.ConnRate = float64(info.Accepts) / elapsed
+				info.BytesOutPerSec = float64(sent) / elapsed
+				info.BytesInPerSec = float64(received) / elapsed
+			}
+		}
+
+		trafficState[port] = &listenerTraffic{scannedAt: now, conns: cur}
+		out[port] = info
+	}
+
+	for port := range trafficState {
+		if !listening[port] {
+			delete(trafficState, port)
+		}
+	}
+	return out
+}
+
+// hasTraffic reports whether connections were opened, closed or moved data
+// since the previous scan
+func (t TrafficInfo) hasTraffic() bool {
+	return t.Accepts > 0 || t.Closes > 0 || t.BytesInPerSec > 0 || t.BytesOutPerSec > 0
+}
@@ -0,0 +1,177 @@
+// Package nerdctl lists and controls containerd containers through the
+// nerdctl CLI. containerd's own API is gRPC; the CLI keeps the engine free of
+// that dependency and handles rootless containerd transparently when run as
+// the owning user.
+package nerdctl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Container is one line of `nerdctl ps --format '{{json .}}'`
+type Container struct {
+	ID     string `json:"ID"`
+	Names  string `json:"Names"`
+	Image  string `json:"Image"`
+	Status string `json:"Status"`
+	Ports  string `json:"Ports"`
+	Labels string `json:"Labels"`
+}
+
+// PortMapping is a host port forwarded to a container port
+type PortMapping struct {
+	HostIP        string
+	HostPort      int
+	ContainerPort int
+	Protocol      string
+}
+
+// Client runs nerdctl, optionally in a non-default containerd namespace
+type Client struct {
+	Path      string
+	Namespace string
+}
+
+// LookPath returns a client for the nerdctl found on PATH
+func LookPath() (*Client, error) {
+	path, err := exec.LookPath("nerdctl")
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Path: path}, nil
+}
+
+func (c *Client) run(ctx context.Context, args ...string) ([]byte, error) {
+	if c.Namespace != "" {
+		args = append([]string{"--namespace", c.Namespace}, args...)
+	}
+	cmd := exec.CommandContext(ctx, c.Path, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("nerdctl %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("nerdctl %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// ListContainers returns the running containers
+func (c *Client) ListContainers(ctx context.Context) ([]Container, error) {
+	out, err := c.run(ctx, "ps", "--no-trunc", "--format", "{{json .}}")
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Container
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var ct Container
+		if err := json.Unmarshal(line, &ct); err != nil {
+			return nil, fmt.Errorf("nerdctl ps: %w", err)
+		}
+		list = append(list, ct)
+	}
+	return list, nil
+}
+
+// StopContainer stops a container, killing it after timeout
+func (c *Client) StopContainer(ctx context.Context, id string, timeout time.Duration) error {
+	_, err := c.run(ctx, "stop", "-t", strconv.Itoa(int(timeout.Seconds())), id)
+	return err
+}
+
+// RestartContainer stops and starts a container again
+func (c *Client) RestartContainer(ctx context.Context, id string, timeout time.Duration) error {
+	_, err := c.run(ctx, "restart", "-t", strconv.Itoa(int(timeout.Seconds())), id)
+	return err
+}
+
+// RemoveContainer deletes a stopped container
+func (c *Client) RemoveContainer(ctx context.Context, id string) error {
+	_, err := c.run(ctx, "rm", id)
+	return err
+}
+
+// ParseLabels decodes the "k=v,k2=v2" label list of nerdctl ps
+func ParseLabels(s string) map[string]string {
+	labels := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok && k != "" {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// ParsePorts decodes the port list of nerdctl ps, e.g.
+// "0.0.0.0:8080->80/tcp, [::]:8000-8001->8000-8001/tcp"
+func ParsePorts(s string) []PortMapping {
+	var out []PortMapping
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		host, target, ok := strings.Cut(item, "->")
+		if !ok {
+			continue
+		}
+		target, proto, _ := strings.Cut(target, "/")
+		if proto == "" {
+			proto = "tcp"
+		}
+
+		i := strings.LastIndexByte(host, ':')
+		if i < 0 {
+			continue
+		}
+		hostIP := strings.Trim(host[:i], "[]")
+		hostFirst, hostLast, ok := portRange(host[i+1:])
+		if !ok {
+			continue
+		}
+		ctrFirst, _, ok := portRange(target)
+		if !ok {
+			continue
+		}
+
+		for p := hostFirst; p <= hostLast; p++ {
+			out = append(out, PortMapping{
+				HostIP:        hostIP,
+				HostPort:      p,
+				ContainerPort: ctrFirst + (p - hostFirst),
+				Protocol:      proto,
+			})
+		}
+	}
+	return out
+}
+
+func portRange(s string) (int, int, bool) {
+	first, last, isRange := strings.Cut(s, "-")
+	a, err := strconv.Atoi(first)
+	if err != nil {
+		return 0, 0, false
+	}
+	if !isRange {
+		return a, a, true
+	}
+	b, err := strconv.Atoi(last)
+	if err != nil || b < a {
+		return 0, 0, false
+	}
+	return a, b, true
+}
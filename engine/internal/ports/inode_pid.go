@@ -3,6 +3,7 @@ package ports
 import (
 	"os"
 	"path/filepath"
+	"runstate/engine/internal/procfs"
 	"strconv"
 	"strings"
 )
@@ -10,7 +11,7 @@ import (
 // InodeToPID maps a socket inode to a PID by scanning /proc.
 // Requires root permission to see PIDs for all sockets.
 func InodeToPID(inode string) (int32, bool) {
-	procEntries, _ := os.ReadDir("/proc")
+	procEntries, _ := os.ReadDir(procfs.Root)
 
 	for _, e := range procEntries {
 		if !e.IsDir() {
@@ -22,7 +23,7 @@ func InodeToPID(inode string) (int32, bool) {
 			continue
 		}
 
-		fdDir := filepath.Join("/proc", pid, "fd")
+		fdDir := filepath.Join(procfs.Root, pid, "fd")
 		fds, err := os.ReadDir(fdDir)
 		if err != nil {
 			continue
@@ -43,3 +44,62 @@ func InodeToPID(inode string) (int32, bool) {
 
 	return 0, false
 }
+
+// SocketOwners maps every socket inode to the PID holding it in a single scan
+// of /proc, for callers that need more than a few lookups. A socket shared
+// after fork is attributed to one of its holders.
+func SocketOwners() map[string]int32 {
+	return socketOwners(nil)
+}
+
+// SocketOwnersOf is SocketOwners limited to the given inodes. The scan stops
+// once all of them are found.
+func SocketOwnersOf(inodes map[string]bool) map[string]int32 {
+	if len(inodes) == 0 {
+		return map[string]int32{}
+	}
+	return socketOwners(inodes)
+}
+
+// socketOwners scans /proc/*/fd for the sockets in want, or all sockets when
+// want is nil
+func socketOwners(want map[string]bool) map[string]int32 {
+	owners := make(map[string]int32)
+	procEntries, _ := os.ReadDir(procfs.Root)
+
+	for _, e := range procEntries {
+		name := e.Name()
+		if !e.IsDir() || name[0] < '0' || name[0] > '9' {
+			continue
+		}
+		pid, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+
+		fdDir := filepath.Join(procfs.Root, name, "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil {
+				continue
+			}
+			if inode, ok := strings.CutPrefix(link, "socket:["); ok {
+				inode = strings.TrimSuffix(inode, "]")
+				if want != nil && !want[inode] {
+					continue
+				}
+				if _, seen := owners[inode]; !seen {
+					owners[inode] = int32(pid)
+				}
+			}
+		}
+		if want != nil && len(owners) == len(want) {
+			break
+		}
+	}
+	return owners
+}
@@ -0,0 +1,61 @@
+package ports
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runstate/engine/internal/procfs"
+	"strconv"
+	"strings"
+)
+
+// ListenStats are the system-wide listen queue counters from the TcpExt
+// section of /proc/net/netstat
+type ListenStats struct {
+	// Overflows counts connections that completed the handshake while the
+	// accept queue was full
+	Overflows uint64
+	// Drops counts every SYN or handshake dropped by a listener, including
+	// overflows
+	Drops uint64
+}
+
+// ReadListenStats reads ListenOverflows and ListenDrops
+func ReadListenStats() (ListenStats, error) {
+	f, err := os.Open(procfs.Root + "/net/netstat")
+	if err != nil {
+		return ListenStats{}, err
+	}
+	defer f.Close()
+
+	// Each section is a header line of names followed by a line of values
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		names := strings.Fields(scanner.Text())
+		if !scanner.Scan() {
+			break
+		}
+		values := strings.Fields(scanner.Text())
+		if len(names) == 0 || names[0] != "TcpExt:" || len(values) != len(names) {
+			continue
+		}
+
+		var st ListenStats
+		found := 0
+		for i, name := range names {
+			switch name {
+			case "ListenOverflows":
+				st.Overflows, _ = strconv.ParseUint(values[i], 10, 64)
+				found++
+			case "ListenDrops":
+				st.Drops, _ = strconv.ParseUint(values[i], 10, 64)
+				found++
+			}
+		}
+		if found == 2 {
+			return st, nil
+		}
+	}
+	return ListenStats{}, fmt.Errorf("/proc/net/netstat: TcpExt listen counters not found")
+}
@@ -0,0 +1,156 @@
+package ports
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"syscall"
+)
+
+// Netlink sock_diag constants from linux/sock_diag.h and linux/inet_diag.h
+const (
+	sockDiagByFamily = 20
+	inetDiagInfo     = 2
+	tcpEstablished   = 1
+	tcpListen        = 10
+
+	inetDiagReqLen = 56
+	inetDiagMsgLen = 72
+
+	// Offsets of tcpi_bytes_acked and tcpi_bytes_received in struct tcp_info
+	// (Linux 4.1+)
+	tcpInfoBytesAcked    = 120
+	tcpInfoBytesReceived = 128
+)
+
+// ByteCounters returns the bytes sent (acked by the peer) and received on
+// each established TCP socket, keyed by socket inode, using NETLINK_SOCK_DIAG.
+// It fails on kernels without sock_diag or without the tcp_info byte counters.
+func ByteCounters() (map[string]SocketBytes, error) {
+	out := make(map[string]SocketBytes)
+	err := sockDiag(1<<tcpEstablished, 1<<(inetDiagInfo-1), func(msg []byte) {
+		parseDiagMsg(msg, out)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListenQueues returns the accept queue length and backlog limit of every
+// listening TCP socket, keyed by inode. Unlike /proc/net/tcp, sock_diag
+// reports the backlog (sk_max_ack_backlog) for listeners.
+func ListenQueues() (map[string]ListenQueue, error) {
+	out := make(map[string]ListenQueue)
+	err := sockDiag(1<<tcpListen, 0, func(msg []byte) {
+		if len(msg) < inetDiagMsgLen {
+			return
+		}
+		native := binary.NativeEndian
+		inode := strconv.FormatUint(uint64(native.Uint32(msg[68:72])), 10)
+		out[inode] = ListenQueue{
+			Queued: int64(native.Uint32(msg[56:60])),
+			Limit:  int64(native.Uint32(msg[60:64])),
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// sockDiag dumps the TCP sockets in states for both address families and
+// calls fn with each inet_diag_msg and its attributes
+func sockDiag(states uint32, ext uint8, fn func(msg []byte)) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, syscall.NETLINK_INET_DIAG)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	tv := syscall.Timeval{Sec: 1}
+	syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv)
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	for _, family := range []uint8{syscall.AF_INET, syscall.AF_INET6} {
+		if err := dumpFamily(fd, family, states, ext, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dumpFamily(fd int, family uint8, states uint32, ext uint8, fn func(msg []byte)) error {
+	req := make([]byte, syscall.NLMSG_HDRLEN+inetDiagReqLen)
+	native := binary.NativeEndian
+	native.PutUint32(req[0:4], uint32(len(req)))
+	native.PutUint16(req[4:6], sockDiagByFamily)
+	native.PutUint16(req[6:8], syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP)
+	native.PutUint32(req[8:12], 1)
+
+	body := req[syscall.NLMSG_HDRLEN:]
+	body[0] = family
+	body[1] = syscall.IPPROTO_TCP
+	body[2] = ext
+	native.PutUint32(body[4:8], states)
+
+	if err := syscall.Sendto(fd, req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 32<<10)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return nil
+			case syscall.NLMSG_ERROR:
+				return errors.New("sock_diag: request rejected")
+			}
+			fn(m.Data)
+		}
+	}
+}
+
+func parseDiagMsg(data []byte, out map[string]SocketBytes) {
+	if len(data) < inetDiagMsgLen {
+		return
+	}
+	native := binary.NativeEndian
+	inode := native.Uint32(data[68:72])
+
+	attrs := data[inetDiagMsgLen:]
+	for len(attrs) >= syscall.SizeofRtAttr {
+		l := int(native.Uint16(attrs[0:2]))
+		t := native.Uint16(attrs[2:4])
+		if l < syscall.SizeofRtAttr || l > len(attrs) {
+			return
+		}
+		if t == inetDiagInfo {
+			info := attrs[syscall.SizeofRtAttr:l]
+			if len(info) >= tcpInfoBytesReceived+8 {
+				out[strconv.FormatUint(uint64(inode), 10)] = SocketBytes{
+					Sent:     native.Uint64(info[tcpInfoBytesAcked:]),
+					Received: native.Uint64(info[tcpInfoBytesReceived:]),
+				}
+			}
+			return
+		}
+		attrs = attrs[rtaAlign(l):]
+	}
+}
+
+func rtaAlign(l int) int {
+	return (l + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package ports
+
+import "errors"
+
+// ByteCounters is only implemented on Linux
+func ByteCounters() (map[string]SocketBytes, error) {
+	return nil, errors.New("sock_diag is not available on this platform")
+}
+
+// ListenQueues is only implemented on Linux
+func ListenQueues() (map[string]ListenQueue, error) {
+	return nil, errors.New("sock_diag is not available on this platform")
+}
@@ -0,0 +1,106 @@
+package ports
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runstate/engine/internal/procfs"
+	"strings"
+)
+
+// Socket is one entry of the socket tables in /proc/<pid>/net
+type Socket struct {
+	Protocol   string `json:"protocol"` // tcp, tcp6, udp, udp6 or unix
+	State      string `json:"state,omitempty"`
+	LocalAddr  string `json:"local_addr,omitempty"`
+	LocalPort  int    `json:"local_port,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	RemotePort int    `json:"remote_port,omitempty"`
+	Path       string `json:"path,omitempty"` // bound unix socket path
+}
+
+// tcpStates names the st column of /proc/net/tcp
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED", "02": "SYN_SENT", "03": "SYN_RECV", "04": "FIN_WAIT1",
+	"05": "FIN_WAIT2", "06": "TIME_WAIT", "07": "CLOSE", "08": "CLOSE_WAIT",
+	"09": "LAST_ACK", "0A": "LISTEN", "0B": "CLOSING",
+}
+
+// NetSockets reads the TCP, UDP and unix socket tables as seen by a process,
+// keyed by inode. Going through /proc/<pid>/net rather than /proc/net picks
+// the process's own network namespace, e.g. inside a container.
+func NetSockets(pid int32) map[string]Socket {
+	out := make(map[string]Socket)
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		readInetTable(fmt.Sprintf("%s/%d/net/%s", procfs.Root, pid, proto), proto, out)
+	}
+	readUnixTable(fmt.Sprintf("%s/%d/net/unix", procfs.Root, pid), out)
+	return out
+}
+
+func readInetTable(path, proto string, out map[string]Socket) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // skip header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		local, lport, ok := splitHexAddr(fields[1])
+		if !ok {
+			continue
+		}
+		remote, rport, _ := splitHexAddr(fields[2])
+
+		state := tcpStates[fields[3]]
+		if strings.HasPrefix(proto, "udp") {
+			// UDP only distinguishes connected sockets, in ss's terms
+			state = "UNCONN"
+			if fields[3] == "01" {
+				state = "ESTABLISHED"
+			}
+		}
+		s := Socket{Protocol: proto, State: state, LocalAddr: local, LocalPort: lport}
+		if rport != 0 {
+			s.RemoteAddr, s.RemotePort = remote, rport
+		}
+		out[fields[9]] = s
+	}
+}
+
+// readUnixTable parses "Num RefCount Protocol Flags Type St Inode [Path]"
+func readUnixTable(path string, out map[string]Socket) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // skip header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 7 {
+			continue
+		}
+		s := Socket{Protocol: "unix"}
+		switch {
+		case fields[3] == "00010000": // __SO_ACCEPTCON
+			s.State = "LISTEN"
+		case fields[5] == "03":
+			s.State = "ESTABLISHED"
+		default:
+			s.State = "UNCONN"
+		}
+		if len(fields) > 7 {
+			s.Path = fields[7]
+		}
+		out[fields[6]] = s
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"runstate/engine/internal/procfs"
 	"strconv"
 	"strings"
 )
 
+// TcpPort is a LISTEN socket. For listeners RxQueue is the number of
+// connections waiting for accept(); /proc does not expose the backlog limit,
+// see ListenQueues.
 type TcpPort struct {
 	Port      int
 	LocalAddr string
@@ -109,7 +113,7 @@ func parseIPv6(hexStr string) string {
 func ListTCPPorts() ([]TcpPort, error) {
 	var out []TcpPort
 
-	files := []string{"/proc/net/tcp", "/proc/net/tcp6"}
+	files := []string{procfs.Root + "/net/tcp", procfs.Root + "/net/tcp6"}
 	for _, file := range files {
 		f, err := os.Open(file)
 		if err != nil {
@@ -177,3 +181,95 @@ func ListTCPPorts() ([]TcpPort, error) {
 
 	return out, nil
 }
+
+// TcpConn is an established TCP connection from /proc/net/tcp{,6}
+type TcpConn struct {
+	LocalAddr  string
+	LocalPort  int
+	RemoteAddr string
+	RemotePort int
+	Inode      string
+	TxQueue    int64
+	RxQueue    int64
+}
+
+// splitHexAddr decodes an "ADDR:PORT" field of /proc/net/tcp
+func splitHexAddr(field string) (string, int, bool) {
+	parts := strings.Split(field, ":")
+	if len(parts) != 2 {
+		return "", 0, false
+	}
+	p, err := strconv.ParseInt(parts[1], 16, 32)
+	if err != nil {
+		return "", 0, false
+	}
+	switch len(parts[0]) {
+	case 8:
+		return parseIPv4(parts[0]), int(p), true
+	case 32:
+		return parseIPv6(parts[0]), int(p), true
+	}
+	return parts[0], int(p), true
+}
+
+// ListTCPConnections returns all ESTABLISHED TCP connections
+func ListTCPConnections() ([]TcpConn, error) {
+	var out []TcpConn
+
+	for _, file := range []string{procfs.Root + "/net/tcp", procfs.Root + "/net/tcp6"} {
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // skip header
+
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 10 || fields[3] != "01" {
+				continue
+			}
+
+			local, lport, ok := splitHexAddr(fields[1])
+			if !ok {
+				continue
+			}
+			remote, rport, ok := splitHexAddr(fields[2])
+			if !ok {
+				continue
+			}
+
+			var tx, rx int64
+			if queues := strings.Split(fields[4], ":"); len(queues) == 2 {
+				tx, _ = strconv.ParseInt(queues[0], 16, 64)
+				rx, _ = strconv.ParseInt(queues[1], 16, 64)
+			}
+
+			out = append(out, TcpConn{
+				LocalAddr:  local,
+				LocalPort:  lport,
+				RemoteAddr: remote,
+				RemotePort: rport,
+				Inode:      fields[9],
+				TxQueue:    tx,
+				RxQueue:    rx,
+			})
+		}
+		f.Close()
+	}
+
+	return out, nil
+}
+
+// SocketBytes are the byte counters of one TCP socket
+type SocketBytes struct {
+	Sent     uint64
+	Received uint64
+}
+
+// ListenQueue is the accept queue of a listening socket
+type ListenQueue struct {
+	Queued int64
+	Limit  int64
+}
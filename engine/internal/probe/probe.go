@@ -0,0 +1,286 @@
+// Package probe fingerprints the protocol spoken by a local TCP listener.
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result describes what a listener answered to the probes
+type Result struct {
+	Protocol   string    `json:"protocol"` // http, https, tls, ssh, redis, postgresql, mysql, http2, unknown
+	Detail     string    `json:"detail,omitempty"`
+	HTTPStatus int       `json:"http_status,omitempty"`
+	HTTPServer string    `json:"http_server,omitempty"`
+	Title      string    `json:"title,omitempty"`
+	TLSSubject string    `json:"tls_subject,omitempty"`
+	TLSIssuer  string    `json:"tls_issuer,omitempty"`
+	ProbedAt   time.Time `json:"probed_at"`
+}
+
+// Describe returns a short human-readable label for the result
+func (r *Result) Describe() string {
+	switch r.Protocol {
+	case "http", "https":
+		label := strings.ToUpper(r.Protocol) + " Server"
+		if r.HTTPServer != "" {
+			label += " (" + r.HTTPServer + ")"
+		}
+		if r.Title != "" {
+			label += ": " + r.Title
+		}
+		return label
+	case "tls":
+		if r.TLSSubject != "" {
+			return "TLS Service (" + r.TLSSubject + ")"
+		}
+		return "TLS Service"
+	case "ssh":
+		return "SSH Server"
+	case "redis":
+		return "Redis-compatible Server"
+	case "postgresql":
+		return "PostgreSQL-compatible Server"
+	case "mysql":
+		return "MySQL-compatible Server"
+	case "http2":
+		return "HTTP/2 cleartext (likely gRPC)"
+	}
+	return "Unidentified Service"
+}
+
+// ErrNotLocal is returned for addresses outside the loopback range
+var ErrNotLocal = errors.New("probe: refusing to probe a non-loopback address")
+
+// maxBody bounds how much of an HTTP response is read looking for a title
+const maxBody = 64 << 10
+
+// Probe connects to a loopback listener and tries, in order: server banners
+// (SSH, MySQL), TLS, HTTP/1.1, Redis PING, PostgreSQL SSLRequest and the
+// HTTP/2 connection preface. Each attempt uses its own connection bounded by
+// timeout.
+func Probe(host string, port int, timeout time.Duration) (*Result, error) {
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsLoopback() {
+		return nil, ErrNotLocal
+	}
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	res := &Result{Protocol: "unknown", ProbedAt: time.Now()}
+
+	probes := []func(string, time.Duration, *Result) bool{
+		probeBanner,
+		probeTLS,
+		probeHTTP,
+		probeRedis,
+		probePostgres,
+		probeHTTP2,
+	}
+	for _, p := range probes {
+		if p(addr, timeout, res) {
+			return res, nil
+		}
+	}
+	return res, nil
+}
+
+func dial(addr string, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	return conn, nil
+}
+
+// exchange writes req (if any) and returns what the server sends back, at
+// least min and at most max bytes
+func exchange(addr string, timeout time.Duration, req []byte, min, max int) []byte {
+	conn, err := dial(addr, timeout)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	if len(req) > 0 {
+		if _, err := conn.Write(req); err != nil {
+			return nil
+		}
+	}
+	buf := make([]byte, max)
+	n, _ := io.ReadAtLeast(conn, buf, min)
+	return buf[:n]
+}
+
+/* -------------------- server-first protocols -------------------- */
+
+func probeBanner(addr string, timeout time.Duration, res *Result) bool {
+	// Server-first protocols answer quickly; don't spend the full timeout
+	banner := exchange(addr, timeout/2, nil, 1, 512)
+	if len(banner) == 0 {
+		return false
+	}
+
+	if bytes.HasPrefix(banner, []byte("SSH-")) {
+		res.Protocol = "ssh"
+		res.Detail = strings.TrimSpace(firstLine(banner))
+		return true
+	}
+
+	// MySQL initial handshake: 3-byte length, sequence 0, protocol 10,
+	// then a NUL-terminated server version
+	if len(banner) > 5 && banner[3] == 0 && banner[4] == 10 {
+		if end := bytes.IndexByte(banner[5:], 0); end > 0 {
+			res.Protocol = "mysql"
+			res.Detail = string(banner[5 : 5+end])
+			return true
+		}
+	}
+
+	res.Detail = strings.TrimSpace(firstLine(banner))
+	return false
+}
+
+/* -------------------- TLS -------------------- */
+
+func probeTLS(addr string, timeout time.Duration, res *Result) bool {
+	conn, err := dial(addr, timeout)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	// Only the certificate is of interest, never its validity
+	tc := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, ServerName: "localhost", NextProtos: []string{"http/1.1"}})
+	if err := tc.Handshake(); err != nil {
+		return false
+	}
+
+	res.Protocol = "tls"
+	state := tc.ConnectionState()
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		res.TLSSubject = cert.Subject.String()
+		res.TLSIssuer = cert.Issuer.String()
+	}
+
+	if status, server, title, ok := httpRoundTrip(tc, addr); ok {
+		res.Protocol = "https"
+		res.HTTPStatus, res.HTTPServer, res.Title = status, server, title
+	}
+	return true
+}
+
+/* -------------------- HTTP -------------------- */
+
+func probeHTTP(addr string, timeout time.Duration, res *Result) bool {
+	conn, err := dial(addr, timeout)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	status, server, title, ok := httpRoundTrip(conn, addr)
+	if !ok {
+		return false
+	}
+	res.Protocol = "http"
+	res.HTTPStatus, res.HTTPServer, res.Title = status, server, title
+	return true
+}
+
+var titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+func httpRoundTrip(conn net.Conn, addr string) (status int, server string, title string, ok bool) {
+	req := "GET / HTTP/1.1\r\nHost: " + addr + "\r\nUser-Agent: portwatch-probe\r\nAccept: */*\r\nConnection: close\r\n\r\n"
+	if _, err := io.WriteString(conn, req); err != nil {
+		return 0, "", "", false
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return 0, "", "", false
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if m := titleRe.FindSubmatch(body); m != nil {
+		title = strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+		if len(title) > 120 {
+			title = title[:120]
+		}
+	}
+	return resp.StatusCode, resp.Header.Get("Server"), title, true
+}
+
+/* -------------------- Redis -------------------- */
+
+func probeRedis(addr string, timeout time.Duration, res *Result) bool {
+	reply := exchange(addr, timeout, []byte("PING\r\n"), 1, 256)
+	line := firstLine(reply)
+	switch {
+	case strings.HasPrefix(line, "+PONG"):
+		res.Protocol = "redis"
+		return true
+	case strings.HasPrefix(line, "-NOAUTH"), strings.HasPrefix(line, "-ERR"), strings.HasPrefix(line, "-DENIED"):
+		res.Protocol = "redis"
+		res.Detail = strings.TrimSpace(line)
+		return true
+	}
+	return false
+}
+
+/* -------------------- PostgreSQL -------------------- */
+
+// postgresSSLRequest is the 8-byte SSLRequest startup packet
+var postgresSSLRequest = func() []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint32(b[0:4], 8)
+	binary.BigEndian.PutUint32(b[4:8], 80877103)
+	return b
+}()
+
+func probePostgres(addr string, timeout time.Duration, res *Result) bool {
+	reply := exchange(addr, timeout, postgresSSLRequest, 1, 1)
+	if len(reply) == 1 && (reply[0] == 'S' || reply[0] == 'N') {
+		res.Protocol = "postgresql"
+		if reply[0] == 'S' {
+			res.Detail = "SSL supported"
+		}
+		return true
+	}
+	return false
+}
+
+/* -------------------- HTTP/2 -------------------- */
+
+// http2Preface is the client connection preface followed by an empty
+// SETTINGS frame
+var http2Preface = append([]byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"), 0, 0, 0, 4, 0, 0, 0, 0, 0)
+
+func probeHTTP2(addr string, timeout time.Duration, res *Result) bool {
+	reply := exchange(addr, timeout, http2Preface, 9, 9)
+	// A server answers with its own SETTINGS frame: type 0x4 at offset 3
+	if len(reply) == 9 && reply[3] == 0x4 {
+		res.Protocol = "http2"
+		return true
+	}
+	return false
+}
+
+func firstLine(b []byte) string {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,114 @@
+package proc
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// interpreterFlags lists, per interpreter, the options that consume the next
+// argument. Anything else starting with "-" is treated as a standalone flag.
+var interpreterFlags = map[string][]string{
+	"node":   {"-r", "--require", "--import", "--loader", "--experimental-loader", "--env-file", "--conditions", "-C", "--title"},
+	"bun":    {"--cwd", "--config", "-c", "--env-file", "--preload", "-r"},
+	"deno":   {"--config", "-c", "--import-map", "--env-file", "--location", "--lock", "--cert"},
+	"python": {"-W", "-X", "-Q"},
+	"ruby":   {"-r", "-I", "-C", "-E", "-x"},
+	"java":   {"-cp", "-classpath", "--class-path", "-p", "--module-path", "--add-opens", "--add-exports", "--add-modules"},
+	"php":    {"-c", "-d", "-t", "-z"},
+}
+
+// Interpreter returns the normalised interpreter name (node, python, ruby,
+// java, bun, deno, php) for an executable path or argv[0], or "".
+func Interpreter(exe string) string {
+	base := strings.ToLower(filepath.Base(exe))
+	base = strings.TrimRight(base, "0123456789.")
+	switch base {
+	case "nodejs":
+		base = "node"
+	case "pypy", "python-dbg":
+		base = "python"
+	case "php-cli":
+		base = "php"
+	}
+	if _, ok := interpreterFlags[base]; ok {
+		return base
+	}
+	return ""
+}
+
+// ParseEntrypoint finds the script, module or jar an interpreter was asked to
+// run, so that "node /x/vite.js" is identified as vite and "python -m uvicorn"
+// as uvicorn. It returns the interpreter name, the entry point and its index
+// in args. For non-interpreted executables it returns ("", "", -1).
+func ParseEntrypoint(args []string, exe string) (interpreter string, entrypoint string, index int) {
+	if len(args) == 0 {
+		return "", "", -1
+	}
+	interpreter = Interpreter(args[0])
+	if interpreter == "" && exe != "" {
+		interpreter = Interpreter(exe)
+	}
+	if interpreter == "" {
+		return "", "", -1
+	}
+
+	withValue := make(map[string]bool)
+	for _, f := range interpreterFlags[interpreter] {
+		withValue[f] = true
+	}
+
+	for i := 1; i < len(args); i++ {
+		a := args[i]
+
+		switch interpreter {
+		case "python":
+			if a == "-m" && i+1 < len(args) {
+				return interpreter, args[i+1], i + 1
+			}
+			if a == "-c" {
+				return interpreter, "-c", i
+			}
+		case "java":
+			if a == "-jar" && i+1 < len(args) {
+				return interpreter, args[i+1], i + 1
+			}
+			if a == "-m" || a == "--module" {
+				if i+1 < len(args) {
+					return interpreter, args[i+1], i + 1
+				}
+			}
+		case "node", "ruby":
+			if a == "-e" || a == "--eval" || a == "-p" || a == "--print" {
+				return interpreter, "-e", i
+			}
+		case "bun", "deno":
+			// "bun run x", "deno run --allow-net x": skip the subcommand
+			if i == 1 && (a == "run" || a == "x" || a == "serve" || a == "task") {
+				continue
+			}
+		case "php":
+			if a == "-S" {
+				return interpreter, "-S", i
+			}
+			if a == "-f" && i+1 < len(args) {
+				return interpreter, args[i+1], i + 1
+			}
+		}
+
+		if a == "--" {
+			if i+1 < len(args) {
+				return interpreter, args[i+1], i + 1
+			}
+			break
+		}
+		if strings.HasPrefix(a, "-") {
+			if withValue[a] {
+				i++
+			}
+			continue
+		}
+		return interpreter, a, i
+	}
+
+	return interpreter, "", -1
+}
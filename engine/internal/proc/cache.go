@@ -0,0 +1,126 @@
+package proc
+
+import (
+	"fmt"
+	"os"
+	"runstate/engine/internal/procfs"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+/* -------------------- incremental scanning -------------------- */
+
+// Name, argv, exe, user, cwd and cgroup are read once per process
+// incarnation, identified by PID and start time so that a reused PID is
+// read afresh. PPID and memory change and are refreshed on every scan from
+// a single read of /proc/<pid>/stat.
+
+// procCacheTTL drops entries not seen by any scan for this long
+const procCacheTTL = 5 * time.Minute
+
+type cachedProc struct {
+	startTicks uint64 // starttime field of /proc/<pid>/stat
+	info       ProcInfo
+	seen       time.Time
+}
+
+var (
+	cacheMu   sync.Mutex
+	procCache = make(map[int32]*cachedProc)
+	pageSize  = uint64(os.Getpagesize())
+)
+
+// procStat holds the volatile fields of /proc/<pid>/stat
+type procStat struct {
+	ppid       int32
+	startTicks uint64
+	rssBytes   uint64
+}
+
+// cachedProcInfo returns the metadata of a process, reading the stable
+// fields through gopsutil only for processes not seen before
+func cachedProcInfo(pid int32) (ProcInfo, bool) {
+	if runtime.GOOS != "linux" {
+		p, err := process.NewProcess(pid)
+		if err != nil {
+			return ProcInfo{}, false
+		}
+		return procInfo(p), true
+	}
+
+	st, ok := readProcStat(pid)
+	if !ok {
+		return ProcInfo{}, false
+	}
+	now := time.Now()
+
+	cacheMu.Lock()
+	if c, hit := procCache[pid]; hit && c.startTicks == st.startTicks {
+		c.info.PPID = st.ppid
+		c.info.MemoryMB = float64(st.rssBytes) / 1024 / 1024
+		c.seen = now
+		info := c.info
+		cacheMu.Unlock()
+		return info, true
+	}
+	cacheMu.Unlock()
+
+	// Reading its stat proved the process exists; NewProcess would check
+	// again, outside procfs.Root when that is not a mount point
+	info := procInfo(&process.Process{Pid: pid})
+
+	cacheMu.Lock()
+	procCache[pid] = &cachedProc{startTicks: st.startTicks, info: info, seen: now}
+	cacheMu.Unlock()
+	return info, true
+}
+
+// pruneCache forgets processes missing from a full scan, or not seen lately
+// when live is nil
+func pruneCache(live map[int32]ProcInfo) {
+	cutoff := time.Now().Add(-procCacheTTL)
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	for pid, c := range procCache {
+		_, alive := live[pid]
+		if (live != nil && !alive) || c.seen.Before(cutoff) {
+			delete(procCache, pid)
+		}
+	}
+	for pid, c := range exeHashes {
+		_, alive := live[pid]
+		if (live != nil && !alive) || c.seen.Before(cutoff) {
+			delete(exeHashes, pid)
+		}
+	}
+}
+
+func readProcStat(pid int32) (procStat, bool) {
+	data, err := os.ReadFile(fmt.Sprintf("%s/%d/stat", procfs.Root, pid))
+	if err != nil {
+		return procStat{}, false
+	}
+	// Fields resume after the last ')' of the command name, starting with
+	// field 3 (state)
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 {
+		return procStat{}, false
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 22 {
+		return procStat{}, false
+	}
+	ppid, err1 := strconv.ParseInt(fields[1], 10, 32)    // field 4
+	start, err2 := strconv.ParseUint(fields[19], 10, 64) // field 22
+	rss, err3 := strconv.ParseUint(fields[21], 10, 64)   // field 24, in pages
+	if err1 != nil || err2 != nil || err3 != nil {
+		return procStat{}, false
+	}
+	return procStat{ppid: int32(ppid), startTicks: start, rssBytes: rss * pageSize}, true
+}
@@ -0,0 +1,189 @@
+package proc
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"runstate/engine/internal/procfs"
+	"runtime"
+	"strings"
+)
+
+// CgroupInfo is what a process's cgroup path says about who owns it
+type CgroupInfo struct {
+	Path string `json:"path"`
+
+	// Innermost systemd unit, e.g. "nginx.service" or "session-2.scope"
+	Unit     string `json:"unit,omitempty"`
+	UnitType string `json:"unit_type,omitempty"` // service, scope or slice
+	Slice    string `json:"slice,omitempty"`     // slice enclosing Unit
+	Manager  string `json:"manager,omitempty"`   // "system" or "user"
+
+	ContainerID      string `json:"container_id,omitempty"`
+	ContainerRuntime string `json:"container_runtime,omitempty"` // docker, podman, containerd, cri-o
+	PodUID           string `json:"pod_uid,omitempty"`
+	PodQoS           string `json:"pod_qos,omitempty"` // guaranteed, burstable or besteffort
+
+	FlatpakApp string `json:"flatpak_app,omitempty"`
+	SnapApp    string `json:"snap_app,omitempty"`
+
+	// OwnerKind and Owner name the most specific owner for grouping:
+	// pod, container, flatpak, snap, service or scope
+	OwnerKind string `json:"owner_kind,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+}
+
+var (
+	// Scopes created by container runtimes under the systemd cgroup driver
+	containerScope = regexp.MustCompile(`^(docker|libpod|cri-containerd|crio|nerdctl)-([0-9a-f]{12,64})\.scope$`)
+	containerID    = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	podSlice       = regexp.MustCompile(`^kubepods(?:-(besteffort|burstable))?-pod([0-9a-f_]+)\.slice$`)
+	podDir         = regexp.MustCompile(`^pod([0-9a-f-]{36})$`)
+	userManager    = regexp.MustCompile(`^user@\d+\.service$`)
+	// app-flatpak-<app id>-<instance>.scope
+	flatpakScope = regexp.MustCompile(`^app-flatpak-(.+)-\d+\.scope$`)
+	// snap.<snap>.<app>-<uuid>.scope for user apps, snap.<snap>.<app>.service for daemons
+	snapUnit = regexp.MustCompile(`^snap\.([^.]+)\.([^.]+?)(?:-[0-9a-f-]{36})?\.(?:scope|service)$`)
+)
+
+var runtimeNames = map[string]string{
+	"docker":         "docker",
+	"libpod":         "podman",
+	"cri-containerd": "containerd",
+	"nerdctl":        "containerd",
+	"crio":           "cri-o",
+}
+
+// ReadCgroup parses /proc/<pid>/cgroup. It returns nil off Linux or when the
+// process is gone.
+func ReadCgroup(pid int32) *CgroupInfo {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+	data, err := os.ReadFile(fmt.Sprintf("%s/%d/cgroup", procfs.Root, pid))
+	if err != nil {
+		return nil
+	}
+	path := cgroupPath(string(data))
+	if path == "" || path == "/" {
+		return nil
+	}
+	return ParseCgroupPath(path)
+}
+
+// cgroupPath picks the hierarchy that reflects systemd's view: the unified
+// (v2) hierarchy when a process is placed in it, else the v1 name=systemd one
+func cgroupPath(data string) string {
+	var unified, named, first string
+	for _, line := range strings.Split(data, "\n") {
+		// Example v1: 1:name=systemd:/system.slice/redis-server.service
+		// Example v2: 0::/system.slice/redis-server.service
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		switch {
+		case parts[0] == "0" && parts[1] == "":
+			unified = parts[2]
+		case parts[1] == "name=systemd":
+			named = parts[2]
+		case first == "":
+			first = parts[2]
+		}
+	}
+	// On hybrid setups the unified hierarchy exists but stays at "/"
+	for _, p := range []string{unified, named, first} {
+		if p != "" && p != "/" {
+			return p
+		}
+	}
+	return unified
+}
+
+// ParseCgroupPath interprets a cgroup path produced by systemd, the cgroupfs
+// driver of container runtimes, or the kubelet
+func ParseCgroupPath(path string) *CgroupInfo {
+	info := &CgroupInfo{Path: path}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	manager := "system"
+	parent := ""
+	for _, seg := range segments {
+		switch {
+		case userManager.MatchString(seg):
+			// Units below user@<uid>.service belong to the user's manager
+			manager = "user"
+		case strings.HasSuffix(seg, ".slice"):
+			info.Slice = seg
+			if m := podSlice.FindStringSubmatch(seg); m != nil {
+				info.PodUID = strings.ReplaceAll(m[2], "_", "-")
+				info.PodQoS = podQoS(m[1])
+			}
+		case strings.HasSuffix(seg, ".service"), strings.HasSuffix(seg, ".scope"):
+			info.Unit = seg
+			info.UnitType = seg[strings.LastIndexByte(seg, '.')+1:]
+			info.Manager = manager
+			if m := containerScope.FindStringSubmatch(seg); m != nil && info.ContainerID == "" {
+				info.ContainerID, info.ContainerRuntime = m[2], runtimeNames[m[1]]
+			}
+			if m := flatpakScope.FindStringSubmatch(seg); m != nil {
+				info.FlatpakApp = m[1]
+			}
+			if m := snapUnit.FindStringSubmatch(seg); m != nil {
+				info.SnapApp = m[1] + "." + m[2]
+			}
+		case podDir.MatchString(seg) && segments[0] == "kubepods":
+			// cgroupfs driver: /kubepods/[<qos>/]pod<uid>/<container id>
+			info.PodUID = seg[len("pod"):]
+			info.PodQoS = "guaranteed"
+			if parent != "kubepods" {
+				info.PodQoS = parent
+			}
+		case containerID.MatchString(seg) && info.ContainerID == "":
+			// cgroupfs driver: /docker/<id>, /<containerd namespace>/<id>,
+			// or a container below a pod
+			info.ContainerID = seg
+			switch {
+			case parent == "docker":
+				info.ContainerRuntime = "docker"
+			case info.PodUID == "":
+				info.ContainerRuntime = "containerd"
+			}
+		}
+		parent = seg
+	}
+
+	if info.Unit == "" && info.Slice != "" {
+		info.Unit, info.UnitType, info.Manager = info.Slice, "slice", manager
+	}
+
+	switch {
+	case info.PodUID != "":
+		info.OwnerKind, info.Owner = "pod", info.PodUID
+	case info.ContainerID != "":
+		info.OwnerKind, info.Owner = "container", info.ContainerID
+	case info.FlatpakApp != "":
+		info.OwnerKind, info.Owner = "flatpak", info.FlatpakApp
+	case info.SnapApp != "":
+		info.OwnerKind, info.Owner = "snap", info.SnapApp
+	case info.UnitType == "service", info.UnitType == "scope":
+		info.OwnerKind, info.Owner = info.UnitType, info.Unit
+	}
+	return info
+}
+
+func podQoS(class string) string {
+	if class == "" {
+		return "guaranteed"
+	}
+	return class
+}
+
+// Service returns the systemd service the process runs in, if any,
+// including services of a user's manager
+func (c *CgroupInfo) Service() string {
+	if c == nil || c.UnitType != "service" {
+		return ""
+	}
+	return c.Unit
+}
@@ -0,0 +1,272 @@
+package proc
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runstate/engine/internal/procfs"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Thresholds for flagging a process as close to a limit
+const (
+	fdLimitWarn     = 0.8
+	memoryLimitWarn = 0.9
+)
+
+// Resources is the memory, IO and file-descriptor usage of a process
+type Resources struct {
+	// From /proc/<pid>/smaps_rollup. PSS splits shared pages between the
+	// processes mapping them; USS counts only pages private to this one.
+	RSSBytes  uint64 `json:"rss_bytes"`
+	PSSBytes  uint64 `json:"pss_bytes"`
+	USSBytes  uint64 `json:"uss_bytes"`
+	SwapBytes uint64 `json:"swap_bytes"`
+
+	Memory *CgroupMemory `json:"cgroup_memory,omitempty"`
+	IO     *IOCounters   `json:"io,omitempty"`
+	FDs    *FDUsage      `json:"fds,omitempty"`
+
+	NearFDLimit     bool     `json:"near_fd_limit"`
+	NearMemoryLimit bool     `json:"near_memory_limit"`
+	Warnings        []string `json:"warnings,omitempty"`
+}
+
+// CgroupMemory is the usage and limit of the memory cgroup a process is in.
+// LimitBytes is 0 when the cgroup is unlimited.
+type CgroupMemory struct {
+	Path        string  `json:"path"`
+	UsageBytes  uint64  `json:"usage_bytes"`
+	LimitBytes  uint64  `json:"limit_bytes,omitempty"`
+	Utilization float64 `json:"utilization,omitempty"`
+}
+
+// IOCounters are from /proc/<pid>/io. The chars counters include reads
+// served from the page cache; the bytes counters are what hit storage.
+type IOCounters struct {
+	ReadChars  uint64 `json:"read_chars"`
+	WriteChars uint64 `json:"write_chars"`
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+}
+
+// FDUsage is the number of open descriptors against RLIMIT_NOFILE. A limit
+// of 0 means unlimited.
+type FDUsage struct {
+	Open        int     `json:"open"`
+	SoftLimit   uint64  `json:"soft_limit,omitempty"`
+	HardLimit   uint64  `json:"hard_limit,omitempty"`
+	Utilization float64 `json:"utilization,omitempty"`
+}
+
+// ReadResources collects what is readable of a process's resource usage.
+// Other users' processes usually only expose part of it; it returns nil off
+// Linux.
+func ReadResources(pid int32) *Resources {
+	if runtime.GOOS != "linux" || pid <= 0 {
+		return nil
+	}
+	r := &Resources{}
+
+	if fields := readKeyed(fmt.Sprintf("%s/%d/smaps_rollup", procfs.Root, pid)); fields != nil {
+		// Values are in kB
+		r.RSSBytes = fields["Rss"] * 1024
+		r.PSSBytes = fields["Pss"] * 1024
+		r.USSBytes = (fields["Private_Clean"] + fields["Private_Dirty"]) * 1024
+		r.SwapBytes = fields["Swap"] * 1024
+	}
+
+	if fields := readKeyed(fmt.Sprintf("%s/%d/io", procfs.Root, pid)); fields != nil {
+		r.IO = &IOCounters{
+			ReadChars:  fields["rchar"],
+			WriteChars: fields["wchar"],
+			ReadBytes:  fields["read_bytes"],
+			WriteBytes: fields["write_bytes"],
+		}
+	}
+
+	if entries, err := os.ReadDir(fmt.Sprintf("%s/%d/fd", procfs.Root, pid)); err == nil {
+		r.FDs = &FDUsage{Open: len(entries)}
+		r.FDs.SoftLimit, r.FDs.HardLimit = openFilesLimit(pid)
+		if r.FDs.SoftLimit > 0 {
+			r.FDs.Utilization = float64(r.FDs.Open) / float64(r.FDs.SoftLimit)
+			if r.FDs.Utilization >= fdLimitWarn {
+				r.NearFDLimit = true
+				r.Warnings = append(r.Warnings, fmt.Sprintf("%d of %d file descriptors in use (%.0f%%)",
+					r.FDs.Open, r.FDs.SoftLimit, r.FDs.Utilization*100))
+			}
+		}
+	}
+
+	r.Memory = cgroupMemory(pid)
+	if m := r.Memory; m != nil && m.LimitBytes > 0 {
+		m.Utilization = float64(m.UsageBytes) / float64(m.LimitBytes)
+		if m.Utilization >= memoryLimitWarn {
+			r.NearMemoryLimit = true
+			r.Warnings = append(r.Warnings, fmt.Sprintf("cgroup %s uses %.0f%% of its %d MB memory limit",
+				m.Path, m.Utilization*100, m.LimitBytes/1024/1024))
+		}
+	}
+	return r
+}
+
+// readKeyed parses "key: value [kB]" lines into a map
+func readKeyed(path string) map[string]uint64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	out := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		if n, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			out[key] = n
+		}
+	}
+	if scanner.Err() != nil || len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// Limit is one row of /proc/<pid>/limits
+type Limit struct {
+	Name string `json:"name"`
+	Soft string `json:"soft"` // a number or "unlimited"
+	Hard string `json:"hard"`
+	Unit string `json:"unit,omitempty"`
+}
+
+// ReadLimits parses /proc/<pid>/limits. Resource names contain spaces, so
+// columns are located by the header.
+func ReadLimits(pid int32) []Limit {
+	data, err := os.ReadFile(fmt.Sprintf("%s/%d/limits", procfs.Root, pid))
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(string(data), "\n")
+	header := lines[0]
+	soft := strings.Index(header, "Soft Limit")
+	hard := strings.Index(header, "Hard Limit")
+	units := strings.Index(header, "Units")
+	if soft < 0 || hard < soft || units < hard {
+		return nil
+	}
+
+	column := func(line string, from, to int) string {
+		if from >= len(line) {
+			return ""
+		}
+		if to < 0 || to > len(line) {
+			to = len(line)
+		}
+		return strings.TrimSpace(line[from:to])
+	}
+	var out []Limit
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		out = append(out, Limit{
+			Name: column(line, 0, soft),
+			Soft: column(line, soft, hard),
+			Hard: column(line, hard, units),
+			Unit: column(line, units, -1),
+		})
+	}
+	return out
+}
+
+// openFilesLimit returns RLIMIT_NOFILE, 0 meaning unlimited
+func openFilesLimit(pid int32) (soft, hard uint64) {
+	for _, l := range ReadLimits(pid) {
+		if l.Name == "Max open files" {
+			soft, _ = strconv.ParseUint(l.Soft, 10, 64)
+			hard, _ = strconv.ParseUint(l.Hard, 10, 64)
+			return soft, hard
+		}
+	}
+	return 0, 0
+}
+
+/* -------------------- cgroup memory -------------------- */
+
+// Limits at or above this are how cgroup v1 spells "unlimited"
+const cgroupV1Unlimited = 1 << 62
+
+// cgroupMemory reads the usage and limit of the memory cgroup of a process,
+// from the v2 hierarchy or the v1 memory controller
+func cgroupMemory(pid int32) *CgroupMemory {
+	data, err := os.ReadFile(fmt.Sprintf("%s/%d/cgroup", procfs.Root, pid))
+	if err != nil {
+		return nil
+	}
+	self, _ := os.ReadFile(procfs.Root + "/self/cgroup")
+
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		var base, usageFile, limitFile string
+		switch {
+		case parts[0] == "0" && parts[1] == "":
+			base, usageFile, limitFile = "/sys/fs/cgroup", "memory.current", "memory.max"
+		case hasController(parts[1], "memory"):
+			base, usageFile, limitFile = "/sys/fs/cgroup/memory", "memory.usage_in_bytes", "memory.limit_in_bytes"
+		default:
+			continue
+		}
+
+		dir := filepath.Join(base, parts[2])
+		if _, err := os.Stat(filepath.Join(dir, usageFile)); err != nil {
+			// Without a cgroup namespace the mount can show our own cgroup
+			// at its root; that only identifies processes sharing it
+			if !strings.Contains(string(self), line) {
+				continue
+			}
+			dir = base
+		}
+		usage, ok := readUint(filepath.Join(dir, usageFile))
+		if !ok {
+			continue
+		}
+		m := &CgroupMemory{Path: parts[2], UsageBytes: usage}
+		if limit, ok := readUint(filepath.Join(dir, limitFile)); ok && limit < cgroupV1Unlimited {
+			m.LimitBytes = limit // v2 "max" fails to parse and stays 0
+		}
+		return m
+	}
+	return nil
+}
+
+func hasController(list, name string) bool {
+	for _, c := range strings.Split(list, ",") {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func readUint(path string) (uint64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	return n, err == nil
+}
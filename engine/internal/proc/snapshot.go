@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"runstate/engine/internal/procfs"
 	"runtime"
 	"strings"
 	"time"
@@ -17,12 +18,18 @@ type ProcInfo struct {
 	PPID          int32     `json:"ppid"`
 	Name          string    `json:"name"`
 	Cmdline       string    `json:"cmdline"`
+	Args          []string  `json:"args,omitempty"`
+	Exe           string    `json:"exe,omitempty"`
+	Interpreter   string    `json:"interpreter,omitempty"`
+	Entrypoint    string    `json:"entrypoint,omitempty"`
 	Username      string    `json:"username"`
 	CreateTime    time.Time `json:"create_time"`
 	MemoryMB      float64   `json:"memory_mb"`
 	Icon          string    `json:"icon"`
 	Cwd           string    `json:"cwd"`
 	SystemService string    `json:"system_service,omitempty"`
+	// Cgroup attributes the process to its unit, container, pod or app
+	Cgroup *CgroupInfo `json:"cgroup,omitempty"`
 }
 
 // Snapshot returns a map of current processes, keyed by PID.
@@ -35,87 +42,177 @@ func Snapshot() (map[int32]ProcInfo, error) {
 		}
 	}()
 
-	procs, err := process.Processes()
+	pids, err := process.Pids()
 	if err != nil {
 		return nil, err
 	}
 
-	result := make(map[int32]ProcInfo)
-
-	for _, p := range procs {
-		if p == nil {
-			continue
+	result := make(map[int32]ProcInfo, len(pids))
+	for _, pid := range pids {
+		if info, ok := cachedProcInfo(pid); ok {
+			result[pid] = info
 		}
+	}
+	pruneCache(result)
+
+	return result, nil
+}
 
-		pid := p.Pid
-
-		// Safely extract metadata, ignoring errors for restricted processes
-		name, _ := p.Name()
-		cmd, _ := p.Cmdline()
-		user, _ := p.Username()
-		ppid, _ := p.Ppid()
-		mem, _ := p.MemoryInfo()
-		ct, _ := p.CreateTime()
-		cwd, _ := p.Cwd()
-
-		memMB := 0.0
-		// Triple-check nil safety for memory info
-		if mem != nil && runtime.GOOS != "" {
-			// Check RSS field explicitly
-			memMB = float64(mem.RSS) / 1024 / 1024
+// SnapshotPIDs is Snapshot restricted to the given PIDs and their ancestors,
+// for callers that only need the owners of a few sockets
+func SnapshotPIDs(pids []int32) map[int32]ProcInfo {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[SnapshotPIDs] Recovered from panic: %v", r)
 		}
+	}()
 
-		// Ensure we don't have crazy create times
-		var createTime time.Time
-		if ct > 0 {
-			createTime = time.UnixMilli(ct)
-		} else {
-			createTime = time.Now()
+	result := make(map[int32]ProcInfo)
+	for _, pid := range pids {
+		// Walk up until init or a process already collected
+		for pid > 0 {
+			if _, done := result[pid]; done {
+				break
+			}
+			info, ok := cachedProcInfo(pid)
+			if !ok {
+				break
+			}
+			result[pid] = info
+			pid = info.PPID
 		}
+	}
+	pruneCache(nil)
+	return result
+}
 
-		result[pid] = ProcInfo{
-			PID:           pid,
-			PPID:          ppid,
-			Name:          name,
-			Cmdline:       cmd,
-			Username:      user,
-			CreateTime:    createTime,
-			MemoryMB:      memMB,
-			Cwd:           cwd,
-			SystemService: detectSystemService(pid),
+// Inspect reads a single process the same way Snapshot does
+func Inspect(pid int32) (info ProcInfo, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[Inspect] Recovered from panic: %v", r)
+			err = fmt.Errorf("reading process %d failed", pid)
 		}
+	}()
+
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return ProcInfo{}, err
 	}
+	return procInfo(p), nil
+}
 
-	return result, nil
+// procInfo collects the metadata of one process, ignoring errors for
+// restricted processes
+func procInfo(p *process.Process) ProcInfo {
+	pid := p.Pid
+
+	// Safely extract metadata, ignoring errors for restricted processes
+	name, _ := p.Name()
+	cmd, _ := p.Cmdline()
+	args, _ := p.CmdlineSlice()
+	exe, _ := p.Exe()
+	user, _ := p.Username()
+	ppid, _ := p.Ppid()
+	mem, _ := p.MemoryInfo()
+	ct, _ := p.CreateTime()
+	cwd, _ := p.Cwd()
+
+	memMB := 0.0
+	// Triple-check nil safety for memory info
+	if mem != nil && runtime.GOOS != "" {
+		// Check RSS field explicitly
+		memMB = float64(mem.RSS) / 1024 / 1024
+	}
+
+	// Ensure we don't have crazy create times
+	var createTime time.Time
+	if ct > 0 {
+		createTime = time.UnixMilli(ct)
+	} else {
+		createTime = time.Now()
+	}
+
+	// The kernel marks replaced binaries, e.g. after a rebuild
+	exe = strings.TrimSuffix(exe, " (deleted)")
+	interpreter, entrypoint, _ := ParseEntrypoint(args, exe)
+	cgroup := ReadCgroup(pid)
+
+	return ProcInfo{
+		PID:           pid,
+		PPID:          ppid,
+		Name:          name,
+		Cmdline:       cmd,
+		Args:          args,
+		Exe:           exe,
+		Interpreter:   interpreter,
+		Entrypoint:    entrypoint,
+		Username:      user,
+		CreateTime:    createTime,
+		MemoryMB:      memMB,
+		Cwd:           cwd,
+		SystemService: cgroup.Service(),
+		Cgroup:        cgroup,
+	}
 }
 
-// detectSystemService attempts to find the systemd service name for a PID
-func detectSystemService(pid int32) string {
-	if runtime.GOOS != "linux" {
-		return ""
+// Environ reads the environment of a process from /proc/<pid>/environ.
+// It returns nil when the process is gone or not readable.
+func Environ(pid int32) map[string]string {
+	if runtime.GOOS != "linux" || pid <= 0 {
+		return nil
 	}
 
-	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	data, err := os.ReadFile(fmt.Sprintf("%s/%d/environ", procfs.Root, pid))
 	if err != nil {
-		return ""
+		return nil
 	}
 
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		// Example v1: 1:name=systemd:/system.slice/redis-server.service
-		// Example v2: 0::/system.slice/redis-server.service
-		if strings.Contains(line, ".service") {
-			parts := strings.Split(line, "/")
-			for i := len(parts) - 1; i >= 0; i-- {
-				part := parts[i]
-				if strings.HasSuffix(part, ".service") {
-					// Handle cases like "system-redis.slice/redis-server.service"
-					// or just "redis-server.service"
-					return part
-				}
-			}
+	env := make(map[string]string)
+	for _, kv := range strings.Split(string(data), "\x00") {
+		if k, v, ok := strings.Cut(kv, "="); ok && k != "" {
+			env[k] = v
 		}
 	}
+	return env
+}
+
+// ControllingTTY returns the device path of a process's controlling terminal
+// from the tty_nr field of /proc/<pid>/stat, or "" when it has none.
+func ControllingTTY(pid int32) string {
+	if runtime.GOOS != "linux" || pid <= 0 {
+		return ""
+	}
 
-	return ""
+	data, err := os.ReadFile(fmt.Sprintf("%s/%d/stat", procfs.Root, pid))
+	if err != nil {
+		return ""
+	}
+	// The command name may contain spaces and parentheses; fields resume
+	// after the last ')'
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 {
+		return ""
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	// state, ppid, pgrp, session, tty_nr
+	if len(fields) < 5 {
+		return ""
+	}
+	var ttyNr uint64
+	if _, err := fmt.Sscan(fields[4], &ttyNr); err != nil || ttyNr == 0 {
+		return ""
+	}
+
+	major := (ttyNr >> 8) & 0xfff
+	minor := (ttyNr & 0xff) | ((ttyNr >> 12) & 0xfff00)
+	switch {
+	case major >= 136 && major <= 143:
+		return fmt.Sprintf("/dev/pts/%d", (major-136)*256+minor)
+	case major == 4 && minor < 64:
+		return fmt.Sprintf("/dev/tty%d", minor)
+	case major == 4:
+		return fmt.Sprintf("/dev/ttyS%d", minor-64)
+	}
+	return fmt.Sprintf("tty(%d:%d)", major, minor)
 }
@@ -0,0 +1,148 @@
+package proc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runstate/engine/internal/procfs"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// benchProcs is the size of the generated process tree
+const benchProcs = 4000
+
+var (
+	fakeOnce sync.Once
+	fakeRoot string
+	fakeErr  error
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if fakeRoot != "" {
+		os.RemoveAll(fakeRoot)
+	}
+	os.Exit(code)
+}
+
+// useFakeProcfs points procfs readers and gopsutil at a generated procfs tree
+// of benchProcs processes, built once per test binary
+func useFakeProcfs(b *testing.B) {
+	b.Helper()
+	if runtime.GOOS != "linux" {
+		b.Skip("procfs layout is Linux-only")
+	}
+	fakeOnce.Do(func() { fakeRoot, fakeErr = writeFakeProcfs(benchProcs) })
+	if fakeErr != nil {
+		b.Fatal(fakeErr)
+	}
+
+	b.Setenv("HOST_PROC", fakeRoot)
+	prev := procfs.Root
+	procfs.Root = fakeRoot
+	b.Cleanup(func() {
+		procfs.Root = prev
+		resetCache()
+	})
+	resetCache()
+}
+
+// writeFakeProcfs generates a procfs tree of n processes, each the child of
+// pid/4
+func writeFakeProcfs(n int) (string, error) {
+	root, err := os.MkdirTemp("", "procfs")
+	if err != nil {
+		return "", err
+	}
+	files := map[string]string{
+		"stat":   "cpu  0 0 0 0 0 0 0 0 0 0\nbtime 1760000000\n",
+		"uptime": "1000.00 4000.00\n",
+	}
+	for pid := 1; pid <= n; pid++ {
+		if err := os.Mkdir(filepath.Join(root, fmt.Sprint(pid)), 0o755); err != nil {
+			return root, err
+		}
+		ppid := pid / 4
+		name := fmt.Sprintf("worker-%d", pid%100)
+		// pid (comm) state ppid ... starttime(22) vsize rss(24) ...
+		stat := []string{fmt.Sprint(pid), "(" + name + ")", "S", fmt.Sprint(ppid)}
+		for field := 5; field <= 52; field++ {
+			switch field {
+			case 22:
+				stat = append(stat, fmt.Sprint(1000+pid))
+			case 24:
+				stat = append(stat, "2560")
+			default:
+				stat = append(stat, "0")
+			}
+		}
+		files[fmt.Sprintf("%d/stat", pid)] = strings.Join(stat, " ") + "\n"
+		files[fmt.Sprintf("%d/status", pid)] = fmt.Sprintf(
+			"Name:\t%s\nState:\tS (sleeping)\nTgid:\t%d\nPid:\t%d\nPPid:\t%d\nUid:\t0\t0\t0\t0\nGid:\t0\t0\t0\t0\nThreads:\t1\n",
+			name, pid, pid, ppid)
+		files[fmt.Sprintf("%d/cmdline", pid)] = "/usr/bin/" + name + "\x00--port\x00" + fmt.Sprint(3000+pid) + "\x00"
+		files[fmt.Sprintf("%d/statm", pid)] = "5000 2560 100 10 0 300 0\n"
+		files[fmt.Sprintf("%d/cgroup", pid)] = "0::/user.slice/user-1000.slice/session-1.scope\n"
+	}
+	for path, data := range files {
+		if err := os.WriteFile(filepath.Join(root, path), []byte(data), 0o644); err != nil {
+			return root, err
+		}
+	}
+	return root, nil
+}
+
+// resetCache forgets everything cached per process incarnation
+func resetCache() {
+	cacheMu.Lock()
+	clear(procCache)
+	clear(exeHashes)
+	cacheMu.Unlock()
+}
+
+func BenchmarkSnapshot(b *testing.B) {
+	useFakeProcfs(b)
+
+	b.Run("cold", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			resetCache()
+			b.StartTimer()
+			if procs, err := Snapshot(); err != nil || len(procs) != benchProcs {
+				b.Fatalf("Snapshot: %d processes, %v", len(procs), err)
+			}
+		}
+	})
+
+	b.Run("warm", func(b *testing.B) {
+		resetCache()
+		Snapshot()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if procs, err := Snapshot(); err != nil || len(procs) != benchProcs {
+				b.Fatalf("Snapshot: %d processes, %v", len(procs), err)
+			}
+		}
+	})
+}
+
+// BenchmarkSnapshotPIDs reads a few listener owners and their ancestors out
+// of the full tree, as SnapshotPorts does
+func BenchmarkSnapshotPIDs(b *testing.B) {
+	useFakeProcfs(b)
+	var owners []int32
+	for pid := benchProcs; len(owners) < 20; pid -= 97 {
+		owners = append(owners, int32(pid))
+	}
+	Snapshot()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if procs := SnapshotPIDs(owners); len(procs) < len(owners) {
+			b.Fatalf("SnapshotPIDs: %d processes for %d owners", len(procs), len(owners))
+		}
+	}
+}
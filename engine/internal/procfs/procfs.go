@@ -0,0 +1,17 @@
+// Package procfs locates the proc filesystem read by the port and process
+// scanners.
+package procfs
+
+import "os"
+
+// Root is where procfs is read from. It follows gopsutil's HOST_PROC so that
+// every reader sees the same tree, e.g. a host /proc mounted into a
+// container.
+var Root = hostProc()
+
+func hostProc() string {
+	if root := os.Getenv("HOST_PROC"); root != "" {
+		return root
+	}
+	return "/proc"
+}
@@ -0,0 +1,193 @@
+package telemetry
+
+import (
+	"fmt"
+	"runstate/engine/internal/engine"
+	"strconv"
+	"time"
+)
+
+// The types below mirror the OTLP/HTTP JSON encoding of
+// opentelemetry.proto.collector.logs.v1.ExportLogsServiceRequest.
+// 64-bit integers are encoded as strings, as the protobuf JSON mapping requires.
+
+type logsRequest struct {
+	ResourceLogs []resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource    `json:"resource"`
+	ScopeLogs []scopeLogs `json:"scopeLogs"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeLogs struct {
+	Scope      scope       `json:"scope"`
+	LogRecords []logRecord `json:"logRecords"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type logRecord struct {
+	TimeUnixNano         string     `json:"timeUnixNano"`
+	ObservedTimeUnixNano string     `json:"observedTimeUnixNano"`
+	SeverityNumber       int        `json:"severityNumber"`
+	SeverityText         string     `json:"severityText"`
+	Body                 anyValue   `json:"body"`
+	Attributes           []keyValue `json:"attributes"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+func str(k, v string) keyValue { return keyValue{Key: k, Value: anyValue{StringValue: &v}} }
+
+func num(k string, v int64) keyValue {
+	s := strconv.FormatInt(v, 10)
+	return keyValue{Key: k, Value: anyValue{IntValue: &s}}
+}
+
+func flag(k string, v bool) keyValue { return keyValue{Key: k, Value: anyValue{BoolValue: &v}} }
+
+const (
+	severityInfo = 9
+	severityWarn = 13
+)
+
+// buildLogsRequest groups events by the process/project that produced them so
+// each group shares one OTLP resource.
+func buildLogsRequest(events []engine.PortEvent) logsRequest {
+	var req logsRequest
+	index := make(map[string]int)
+
+	for _, ev := range events {
+		attrs := resourceAttributes(ev)
+		key := resourceKey(attrs)
+		i, ok := index[key]
+		if !ok {
+			i = len(req.ResourceLogs)
+			index[key] = i
+			req.ResourceLogs = append(req.ResourceLogs, resourceLogs{
+				Resource:  resource{Attributes: attrs},
+				ScopeLogs: []scopeLogs{{Scope: scope{Name: "portwatch.engine"}}},
+			})
+		}
+		sl := &req.ResourceLogs[i].ScopeLogs[0]
+		sl.LogRecords = append(sl.LogRecords, eventRecord(ev))
+	}
+
+	return req
+}
+
+func resourceAttributes(ev engine.PortEvent) []keyValue {
+	attrs := []keyValue{str("service.name", "portwatch-engine")}
+	if ev.PID > 0 {
+		attrs = append(attrs, num("process.pid", int64(ev.PID)))
+	}
+	if p := ev.Process; p != nil {
+		if p.PPID > 0 {
+			attrs = append(attrs, num("process.parent_pid", int64(p.PPID)))
+		}
+		if p.Name != "" {
+			attrs = append(attrs, str("process.executable.name", p.Name))
+		}
+		if p.Cmdline != "" {
+			attrs = append(attrs, str("process.command_line", p.Cmdline))
+		}
+		if p.Username != "" {
+			attrs = append(attrs, str("process.owner", p.Username))
+		}
+		if p.Cwd != "" {
+			attrs = append(attrs, str("process.working_directory", p.Cwd))
+		}
+		if !p.CreateTime.IsZero() {
+			attrs = append(attrs, str("process.creation.time", p.CreateTime.UTC().Format("2006-01-02T15:04:05.000Z07:00")))
+		}
+		if p.SystemService != "" {
+			attrs = append(attrs, str("portwatch.system_service", p.SystemService))
+		}
+		if cg := p.Cgroup; cg != nil {
+			if cg.ContainerID != "" {
+				attrs = append(attrs, str("container.id", cg.ContainerID))
+			}
+			if cg.PodUID != "" {
+				attrs = append(attrs, str("k8s.pod.uid", cg.PodUID))
+			}
+		}
+	}
+	if pr := ev.Project; pr != nil {
+		attrs = append(attrs, str("portwatch.project.name", pr.Name), str("portwatch.project.path", pr.Path))
+	}
+	return attrs
+}
+
+func resourceKey(attrs []keyValue) string {
+	key := ""
+	for _, kv := range attrs {
+		key += kv.Key + "="
+		switch {
+		case kv.Value.StringValue != nil:
+			key += *kv.Value.StringValue
+		case kv.Value.IntValue != nil:
+			key += *kv.Value.IntValue
+		}
+		key += ";"
+	}
+	return key
+}
+
+func eventRecord(ev engine.PortEvent) logRecord {
+	ts := strconv.FormatInt(ev.Time.UnixNano(), 10)
+	rec := logRecord{
+		TimeUnixNano:         ts,
+		ObservedTimeUnixNano: ts,
+		SeverityNumber:       severityInfo,
+		SeverityText:         "INFO",
+		Attributes:           []keyValue{str("event.name", "portwatch."+string(ev.Kind))},
+	}
+	if ev.Port > 0 {
+		rec.Attributes = append(rec.Attributes, num("net.host.port", int64(ev.Port)))
+	}
+	if ev.Insight != nil {
+		rec.Attributes = append(rec.Attributes,
+			str("portwatch.explanation", ev.Insight.Explanation),
+			str("portwatch.category", string(ev.Insight.Category)))
+	}
+
+	var body string
+	switch ev.Kind {
+	case engine.EventPortOpen:
+		body = fmt.Sprintf("port %d opened by pid %d", ev.Port, ev.PID)
+	case engine.EventPortClose:
+		body = fmt.Sprintf("port %d closed (pid %d)", ev.Port, ev.PID)
+	case engine.EventKill:
+		body = fmt.Sprintf("pid %d killed via %s", ev.PID, ev.Phase)
+		rec.Attributes = append(rec.Attributes, str("portwatch.kill.phase", ev.Phase), flag("portwatch.kill.success", ev.Success))
+		if !ev.Success {
+			body = fmt.Sprintf("failed to kill pid %d via %s", ev.PID, ev.Phase)
+			rec.SeverityNumber, rec.SeverityText = severityWarn, "WARN"
+		}
+	case engine.EventReapWarning:
+		body = fmt.Sprintf("pid %d will be stopped at %s by reaper rule %s", ev.PID, ev.ActAt.Format(time.RFC3339), ev.Rule)
+		rec.Attributes = append(rec.Attributes, str("portwatch.reaper.rule", ev.Rule))
+		rec.SeverityNumber, rec.SeverityText = severityWarn, "WARN"
+	default:
+		body = string(ev.Kind)
+	}
+	rec.Body = anyValue{StringValue: &body}
+
+	return rec
+}
@@ -0,0 +1,259 @@
+// Package telemetry exports engine events to an OpenTelemetry collector.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"runstate/engine/internal/engine"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config controls the OTLP/HTTP log exporter
+type Config struct {
+	// Endpoint is the collector base URL, e.g. http://127.0.0.1:4318.
+	// Records are posted to Endpoint + "/v1/logs".
+	Endpoint string
+	Headers  map[string]string
+
+	BatchSize     int
+	FlushInterval time.Duration
+	QueueSize     int
+	MaxRetries    int
+	RetryBackoff  time.Duration
+	Timeout       time.Duration
+}
+
+// DefaultConfig returns the exporter defaults
+func DefaultConfig() Config {
+	return Config{
+		Endpoint:      "http://127.0.0.1:4318",
+		BatchSize:     64,
+		FlushInterval: 5 * time.Second,
+		QueueSize:     2048,
+		MaxRetries:    3,
+		RetryBackoff:  500 * time.Millisecond,
+		Timeout:       5 * time.Second,
+	}
+}
+
+// ConfigFromEnv builds a Config from the standard OTEL_EXPORTER_OTLP_*
+// variables plus PORTWATCH_OTLP_* tuning knobs. ok is false when no endpoint
+// is configured, which disables export.
+func ConfigFromEnv() (cfg Config, ok bool, err error) {
+	cfg = DefaultConfig()
+
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT")
+	if endpoint != "" {
+		cfg.Endpoint = strings.TrimSuffix(endpoint, "/v1/logs")
+	} else if endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		cfg.Endpoint = endpoint
+	} else {
+		return cfg, false, nil
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+
+	if h := os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"); h != "" {
+		cfg.Headers = make(map[string]string)
+		for _, pair := range strings.Split(h, ",") {
+			k, v, found := strings.Cut(pair, "=")
+			if !found {
+				return cfg, false, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS entry %q", pair)
+			}
+			cfg.Headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+
+	ints := map[string]*int{
+		"PORTWATCH_OTLP_BATCH_SIZE":  &cfg.BatchSize,
+		"PORTWATCH_OTLP_QUEUE_SIZE":  &cfg.QueueSize,
+		"PORTWATCH_OTLP_MAX_RETRIES": &cfg.MaxRetries,
+	}
+	for key, dst := range ints {
+		if v := os.Getenv(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return cfg, false, fmt.Errorf("invalid %s %q", key, v)
+			}
+			*dst = n
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"PORTWATCH_OTLP_FLUSH_INTERVAL": &cfg.FlushInterval,
+		"PORTWATCH_OTLP_RETRY_BACKOFF":  &cfg.RetryBackoff,
+		"PORTWATCH_OTLP_TIMEOUT":        &cfg.Timeout,
+	}
+	for key, dst := range durations {
+		if v := os.Getenv(key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return cfg, false, fmt.Errorf("invalid %s %q", key, v)
+			}
+			*dst = d
+		}
+	}
+
+	return cfg, true, nil
+}
+
+// Exporter batches engine events and ships them as OTLP log records
+type Exporter struct {
+	cfg    Config
+	client *http.Client
+	queue  chan engine.PortEvent
+	done   chan struct{}
+	stop   sync.Once
+	wg     sync.WaitGroup
+}
+
+// NewExporter starts the background batching loop. Call Shutdown to flush.
+func NewExporter(cfg Config) *Exporter {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1
+	}
+	if cfg.QueueSize < cfg.BatchSize {
+		cfg.QueueSize = cfg.BatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultConfig().FlushInterval
+	}
+
+	e := &Exporter{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan engine.PortEvent, cfg.QueueSize),
+		done:   make(chan struct{}),
+	}
+	e.wg.Add(1)
+	go e.run()
+	return e
+}
+
+// Handle enqueues an event; it never blocks. Events are dropped when the
+// queue is full, e.g. while the collector is unreachable.
+func (e *Exporter) Handle(ev engine.PortEvent) {
+	select {
+	case e.queue <- ev:
+	default:
+		log.Printf("[otlp] queue full, dropping %s event for pid %d", ev.Kind, ev.PID)
+	}
+}
+
+// Shutdown flushes queued events and stops the exporter. It is safe to call
+// more than once.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.stop.Do(func() { close(e.done) })
+	finished := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *Exporter) run() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]engine.PortEvent, 0, e.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			log.Printf("[otlp] dropping %d events: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case ev := <-e.queue:
+			batch = append(batch, ev)
+			if len(batch) >= e.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.done:
+			for {
+				select {
+				case ev := <-e.queue:
+					batch = append(batch, ev)
+					if len(batch) >= e.cfg.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// send posts a batch, retrying transient failures with exponential backoff
+func (e *Exporter) send(batch []engine.PortEvent) error {
+	body, err := json.Marshal(buildLogsRequest(batch))
+	if err != nil {
+		return err
+	}
+
+	backoff := e.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := e.post(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= e.cfg.MaxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (e *Exporter) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, e.cfg.Endpoint+"/v1/logs", bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	// Per the OTLP/HTTP spec only these statuses are retryable
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true, fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return false, fmt.Errorf("collector returned %s", resp.Status)
+}
@@ -0,0 +1,174 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runstate/engine/internal/engine"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector is an in-process OTLP/HTTP stub. It answers with statuses in
+// order, then 200, and records the size of every batch it receives.
+type collector struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests int
+	batches  []int // log records per accepted request
+}
+
+func newCollector(t *testing.T, statuses ...int) *collector {
+	c := &collector{statuses: statuses}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		var req logsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.requests++
+		if len(c.statuses) > 0 {
+			status := c.statuses[0]
+			c.statuses = c.statuses[1:]
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+		}
+		n := 0
+		for _, rl := range req.ResourceLogs {
+			for _, sl := range rl.ScopeLogs {
+				n += len(sl.LogRecords)
+			}
+		}
+		c.batches = append(c.batches, n)
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+func (c *collector) snapshot() (requests int, batches []int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requests, append([]int(nil), c.batches...)
+}
+
+// waitFor polls until cond holds or the deadline passes
+func (c *collector) waitFor(t *testing.T, cond func(requests int, batches []int) bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond(c.snapshot()) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	requests, batches := c.snapshot()
+	t.Fatalf("collector saw %d requests, batches %v", requests, batches)
+}
+
+func testConfig(endpoint string) Config {
+	cfg := DefaultConfig()
+	cfg.Endpoint = endpoint
+	cfg.FlushInterval = time.Hour
+	cfg.RetryBackoff = time.Millisecond
+	cfg.Timeout = time.Second
+	return cfg
+}
+
+func emit(e *Exporter, n int) {
+	for i := 0; i < n; i++ {
+		e.Handle(engine.PortEvent{Kind: engine.EventPortOpen, Time: time.Now(), Port: 3000 + i, PID: int32(100 + i)})
+	}
+}
+
+func shutdown(t *testing.T, e *Exporter) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+}
+
+func TestBatchesBySize(t *testing.T) {
+	c := newCollector(t)
+	cfg := testConfig(c.URL)
+	cfg.BatchSize = 3
+	e := NewExporter(cfg)
+	defer shutdown(t, e)
+
+	emit(e, 6)
+	c.waitFor(t, func(_ int, batches []int) bool {
+		return len(batches) == 2 && batches[0] == 3 && batches[1] == 3
+	})
+}
+
+func TestBatchesByInterval(t *testing.T) {
+	c := newCollector(t)
+	cfg := testConfig(c.URL)
+	cfg.BatchSize = 100
+	cfg.FlushInterval = 20 * time.Millisecond
+	e := NewExporter(cfg)
+	defer shutdown(t, e)
+
+	emit(e, 2)
+	c.waitFor(t, func(_ int, batches []int) bool {
+		return len(batches) == 1 && batches[0] == 2
+	})
+}
+
+func TestRetriesTransientStatuses(t *testing.T) {
+	c := newCollector(t, http.StatusTooManyRequests, http.StatusServiceUnavailable)
+	cfg := testConfig(c.URL)
+	cfg.BatchSize = 1
+	e := NewExporter(cfg)
+	defer shutdown(t, e)
+
+	emit(e, 1)
+	c.waitFor(t, func(requests int, batches []int) bool {
+		return requests == 3 && len(batches) == 1
+	})
+}
+
+func TestDoesNotRetryBadRequest(t *testing.T) {
+	c := newCollector(t, http.StatusBadRequest)
+	cfg := testConfig(c.URL)
+	cfg.BatchSize = 1
+	e := NewExporter(cfg)
+
+	emit(e, 1)
+	c.waitFor(t, func(requests int, _ []int) bool { return requests == 1 })
+	shutdown(t, e)
+
+	if requests, batches := c.snapshot(); requests != 1 || len(batches) != 0 {
+		t.Fatalf("got %d requests and batches %v, want a single rejected request", requests, batches)
+	}
+}
+
+func TestShutdownFlushesQueue(t *testing.T) {
+	c := newCollector(t)
+	cfg := testConfig(c.URL)
+	cfg.BatchSize = 100
+	e := NewExporter(cfg)
+
+	emit(e, 5)
+	shutdown(t, e)
+
+	if _, batches := c.snapshot(); len(batches) != 1 || batches[0] != 5 {
+		t.Fatalf("batches %v, want one batch of 5 flushed on shutdown", batches)
+	}
+	// A second Shutdown must not panic on the closed channel
+	shutdown(t, e)
+}